@@ -1,65 +1,89 @@
-package main
+package esurfing
 
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
-	"strconv"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
 )
 
 func (c *Client) Auth(URL string) error {
 	log := c.Log
 	c.RedirectUrl = URL
 
-	err := c.GetSchoolInfo()
-	if err != nil {
+	if err := c.stage("GetSchoolInfo", c.GetSchoolInfo); err != nil {
 		return err
 	}
 
-	c.ClientID = uuid.New()
-	c.Hostname = GenerateRandomString(10)
-	c.MacAddress = GenerateRandomMAC()
-
-	err = c.GetEConfig()
-	if err != nil {
+	if err := c.stage("GetIdentity", c.GetIdentity); err != nil {
 		return err
 	}
 
-	err = c.GetUserAndAcIP()
-	if err != nil {
+	if err := c.stage("GetEConfig", c.GetEConfig); err != nil {
 		return err
 	}
 
-	err = c.GetAlgoId()
-	if err != nil {
+	if err := c.stage("GetUserAndAcIP", c.GetUserAndAcIP); err != nil {
 		return err
 	}
 
-	c.cipher = NewCipher(c.AlgoID)
-	if c.cipher == nil {
-		return errors.New("Unknown AlgoID:" + c.AlgoID)
+	err := c.stage("GetAlgoId", func() error {
+		if err := c.GetAlgoId(); err != nil {
+			return err
+		}
+		if !c.Config.PortalKeys && len(c.AlgoKey) > 0 {
+			log.Debug("ignoring key material sent with the algo id", "algo_id", c.AlgoID)
+			c.AlgoKey = nil
+		}
+		ci, err := cipher.NewCipherWithKey(c.AlgoID, c.AlgoKey)
+		if errors.Is(err, cipher.ErrInvalidKeyLength) {
+			//the layout of the key material is not confirmed from a capture yet,
+			//material that does not fit it is no reason to fail the login
+			log.Warn("key material does not fit the algo, using built-in keys", "algo_id", c.AlgoID, "err", err)
+			c.AlgoKey = nil
+			ci, err = cipher.NewCipherWithKey(c.AlgoID, nil)
+		}
+		if errors.Is(err, cipher.ErrUnknownAlgoID) {
+			return fmt.Errorf("%w: %s", ErrUnknownAlgo, c.AlgoID)
+		}
+		if err != nil {
+			return fmt.Errorf("algo %s: %w", c.AlgoID, err)
+		}
+		c.cipher = ci
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	log.Println("algo_id:", c.AlgoID)
+	log.Info("algo negotiated", "algo_id", c.AlgoID, LogKeyClientID, c.ClientID)
 
-	err = c.GetTicket()
-	if err != nil {
+	if err = c.stage("GetTicket", c.GetTicket); err != nil {
 		return err
 	}
 
-	log.Println("ticket:", c.Ticket)
+	log.Debug("ticket received", LogKeyTicket, c.Ticket)
 
 	time.Sleep(time.Millisecond * 333)
 
-	err = c.Login()
-	if err != nil {
+	if err = c.stage("Login", c.Login); err != nil {
 		return err
 	}
 
+	c.updateMetrics(func(m *Metrics) {
+		m.AuthSuccesses++
+		m.AlgoID = c.AlgoID
+	})
+
+	if err = c.saveSession(); err != nil {
+		log.Warn("save state file error", "err", err)
+	}
+
 	return nil
 }
 
@@ -76,6 +100,8 @@ func (c *Client) GetUserAndAcIP() error {
 		return errors.New("missing user ip or ac ip")
 	}
 
+	c.UserIPv6 = c.detectIPv6()
+
 	return nil
 }
 
@@ -103,12 +129,12 @@ func (c *Client) GetEConfig() error {
 		return errors.New(err.Error())
 	}
 
-	eConfigData, err := FormatEConfig(data)
+	eConfigData, err := protocol.FormatEConfig(data)
 	if err != nil {
 		return errors.New(err.Error())
 	}
 
-	eConfig := &EConfig{}
+	eConfig := &protocol.EConfig{}
 
 	err = xml.Unmarshal(eConfigData, eConfig)
 	if err != nil {
@@ -135,6 +161,7 @@ func (c *Client) GetSchoolInfo() error {
 	if err != nil {
 		return errors.New(err.Error())
 	}
+	_ = response.Body.Close()
 
 	if response.Header.Get("domain") != "" && response.Header.Get("area") != "" &&
 		response.Header.Get("schoolid") != "" && response.Header.Get("Location") != "" {
@@ -173,10 +200,12 @@ func (c *Client) GetAlgoId() error {
 		return errors.New(err.Error())
 	}
 
-	c.AlgoID, _, err = DecodeAlgoID(algoIdData)
+	algoID, key, err := protocol.DecodeAlgoID(algoIdData)
 	if err != nil {
 		return errors.New(err.Error())
 	}
+	c.AlgoID = algoID
+	c.AlgoKey = []byte(key)
 
 	return nil
 }
@@ -192,14 +221,23 @@ func (c *Client) GetTicket() error {
 		return errors.New(err.Error())
 	}
 
-	ticketXML := &TicketResponse{}
+	ticketXML := &protocol.TicketResponse{}
 
 	err = xml.Unmarshal(ticketData, ticketXML)
 	if err != nil {
 		return errors.New(err.Error())
 	}
 
+	if err = portalResult(ticketXML.Code, ticketXML.Message); err != nil {
+		return err
+	}
+
 	c.Ticket = ticketXML.Ticket
+	c.TicketExpiry, err = parseExpire(ticketXML.Expire, time.Now())
+	if err != nil {
+		//the ticket itself is fine, heartbeat failures still catch its expiry
+		c.Log.Warn("ignoring ticket expiry", "err", err)
+	}
 	return nil
 }
 
@@ -214,20 +252,33 @@ func (c *Client) Login() error {
 		return errors.New(err.Error())
 	}
 
-	loginResponseXML := &LoginResponse{}
+	loginResponseXML := &protocol.LoginResponse{}
 	err = xml.Unmarshal(responseData, loginResponseXML)
 	if err != nil {
 		return errors.New(err.Error())
 	}
 
+	if err = portalResult(loginResponseXML.Code, loginResponseXML.Message); err != nil {
+		return err
+	}
+	if loginResponseXML.KeepURL == "" {
+		return errors.New("login response carries no keep url")
+	}
+
 	c.KeepUrl = loginResponseXML.KeepURL
 	c.TermUrl = loginResponseXML.TermURL
 
-	keepRetrySec, err := strconv.Atoi(loginResponseXML.KeepRetry)
+	keepRetry, err := parseInterval(loginResponseXML.KeepRetry)
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
 
-	c.heartBeatTicker.Reset(time.Second * time.Duration(keepRetrySec))
+	c.applyLoginPolicy(loginResponseXML)
+	keepRetry = c.limitInterval(keepRetry)
+
+	c.scheduleHeartbeat(keepRetry)
+	c.updateMetrics(func(m *Metrics) {
+		m.HeartbeatInterval = keepRetry
+	})
 	return nil
 }
@@ -1,4 +1,4 @@
-package main
+package cipher
 
 import (
 	"bytes"
@@ -8,6 +8,9 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/emmansun/gmsm/sm4"
 	"github.com/emmansun/gmsm/zuc"
@@ -34,25 +37,155 @@ var (
 	ErrInvalidCiphertextLength = errors.New("ciphertext length must be a multiple of the block size")
 	ErrInvalidPadding          = errors.New("invalid padding")
 	ErrInvalidDataLength       = errors.New("invalid data length")
+	ErrInvalidKeyLength        = errors.New("invalid key length")
+	ErrUnknownAlgoID           = errors.New("unknown algo id")
 )
 
-var cipherRegistry = map[string]func() Cipher{
-	AlgoAesCbc:    func() Cipher { return new(AesCbc) },
-	AlgoAesEcb:    func() Cipher { return new(AesEcb) },
-	AlgoDesEdeCbc: func() Cipher { return new(DesEdeCbc) },
-	AlgoDesEdeEcb: func() Cipher { return new(DesEdeEcb) },
-	AlgoZUC:       func() Cipher { return new(Zuc) },
-	AlgoSm4Cbc:    func() Cipher { return new(Sm4Cbc) },
-	AlgoSm4Ecb:    func() Cipher { return new(Sm4Ecb) },
-	AlgoXTea:      func() Cipher { return new(XTea) },
-	AlgoXTeaIv:    func() Cipher { return new(XTeaIv) },
+// algorithm describes how the key material sent with an algo ID is split
+// into the keys and IV of its cipher.
+type algorithm struct {
+	name     string
+	keySizes []int
+	new      func(k [][]byte) Cipher
+}
+
+var cipherRegistry = map[string]algorithm{
+	AlgoAesCbc: {"aes-cbc", []int{16, 16, aes.BlockSize}, func(k [][]byte) Cipher {
+		return &AesCbc{key1: k[0], key2: k[1], iv: k[2]}
+	}},
+	AlgoAesEcb: {"aes-ecb", []int{16, 16}, func(k [][]byte) Cipher {
+		return &AesEcb{key1: k[0], key2: k[1]}
+	}},
+	AlgoDesEdeCbc: {"3des-cbc", []int{24, 24, des.BlockSize}, func(k [][]byte) Cipher {
+		return &DesEdeCbc{key1: k[0], key2: k[1], iv: k[2]}
+	}},
+	AlgoDesEdeEcb: {"3des-ecb", []int{24, 24}, func(k [][]byte) Cipher {
+		return &DesEdeEcb{key1: k[0], key2: k[1]}
+	}},
+	AlgoZUC: {"zuc", []int{16, 16}, func(k [][]byte) Cipher {
+		return &Zuc{key: k[0], iv: k[1]}
+	}},
+	AlgoSm4Cbc: {"sm4-cbc", []int{16, 16}, func(k [][]byte) Cipher {
+		return &Sm4Cbc{key: k[0], iv: k[1]}
+	}},
+	AlgoSm4Ecb: {"sm4-ecb", []int{16}, func(k [][]byte) Cipher {
+		return &Sm4Ecb{key: k[0]}
+	}},
+	AlgoXTea: {"xtea", []int{16, 16, 16}, func(k [][]byte) Cipher {
+		return &XTea{key1: words(k[0]), key2: words(k[1]), key3: words(k[2])}
+	}},
+	AlgoXTeaIv: {"xtea-iv", []int{16, 16, 16, 8}, func(k [][]byte) Cipher {
+		return &XTeaIv{key1: words(k[0]), key2: words(k[1]), key3: words(k[2]), iv: words(k[3])}
+	}},
+}
+
+// AlgoIDs returns every supported algorithm ID in a stable order.
+func AlgoIDs() []string {
+	algoIDs := make([]string, 0, len(cipherRegistry))
+	for algoID := range cipherRegistry {
+		algoIDs = append(algoIDs, algoID)
+	}
+	sort.Strings(algoIDs)
+	return algoIDs
+}
+
+// Name returns the short name of algoID, e.g. "sm4-cbc", empty if unknown.
+func Name(algoID string) string {
+	return cipherRegistry[algoID].name
+}
+
+// LookupAlgoID resolves an algo ID or a short name as returned by Name,
+// both case-insensitively.
+func LookupAlgoID(nameOrID string) (string, bool) {
+	for algoID, algo := range cipherRegistry {
+		if strings.EqualFold(nameOrID, algoID) || strings.EqualFold(nameOrID, algo.name) {
+			return algoID, true
+		}
+	}
+	return "", false
+}
+
+// NewCipher returns the cipher for algoID with the built-in keys, or nil if
+// the algorithm is unknown.
+func NewCipher(algoID string) Cipher {
+	c, _ := NewCipherWithKey(algoID, nil)
+	return c
+}
+
+// NewCipherWithKey returns the cipher for algoID using key, the key material
+// the portal sent with the algo ID. The material is the keys of the
+// algorithm followed by its IV, laid out like the built-in ones below
+// (key1, key2, ... then iv), either raw or hex encoded. An empty key selects
+// the built-in keys. This layout is an assumption that has not been checked
+// against a capture of a key rotating portal, so callers should only use
+// portal key material when asked to and fall back to the built-in keys on
+// ErrInvalidKeyLength.
+func NewCipherWithKey(algoID string, key []byte) (Cipher, error) {
+	algo, ok := cipherRegistry[algoID]
+	if !ok {
+		return nil, ErrUnknownAlgoID
+	}
+	k, err := splitKey(key, algo.keySizes...)
+	if err != nil {
+		return nil, err
+	}
+	return algo.new(k), nil
 }
 
-func NewCipher(algoID string) Cipher {
-	if factory, ok := cipherRegistry[algoID]; ok {
-		return factory()
+// KeySize returns the length of the raw key material for algoID, 0 if unknown.
+func KeySize(algoID string) int {
+	size := 0
+	for _, n := range cipherRegistry[algoID].keySizes {
+		size += n
+	}
+	return size
+}
+
+// splitKey cuts key material into parts of the given sizes. An empty key
+// yields nil parts, which the ciphers replace with their built-in keys.
+func splitKey(key []byte, sizes ...int) ([][]byte, error) {
+	parts := make([][]byte, len(sizes))
+	if len(key) == 0 {
+		return parts, nil
+	}
+
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if len(key) != total {
+		//some portals send the material hex encoded
+		decoded, err := hex.DecodeString(string(key))
+		if err != nil || len(decoded) != total {
+			return nil, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidKeyLength, len(key), total)
+		}
+		key = decoded
+	}
+
+	for i, size := range sizes {
+		//cap each part so appending to an IV never writes into the next key
+		parts[i] = key[:size:size]
+		key = key[size:]
+	}
+	return parts, nil
+}
+
+func orDefault[T any](v, def []T) []T {
+	if v == nil {
+		return def
 	}
-	return nil
+	return v
+}
+
+func words(b []byte) []uint32 {
+	if b == nil {
+		return nil
+	}
+	w := make([]uint32, len(b)/4)
+	for i := range w {
+		w[i] = binary.BigEndian.Uint32(b[i*4:])
+	}
+	return w
 }
 
 func encodeHexUpper(data []byte) []byte {
@@ -94,6 +227,11 @@ func pkcs7Unpadding(data []byte, blockSize int) ([]byte, error) {
 	if padding < 1 || padding > blockSize || length < padding {
 		return nil, ErrInvalidPadding
 	}
+	for _, b := range data[length-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidPadding
+		}
+	}
 	return data[:length-padding], nil
 }
 
@@ -137,28 +275,30 @@ var (
 	aesCbcIv   = []byte{0x54, 0x67, 0x70, 0x75, 0x60, 0x73, 0x5A, 0x5C, 0x69, 0x40, 0x42, 0x66, 0x73, 0x5A, 0x7D, 0x5E}
 )
 
-type AesCbc struct{}
+type AesCbc struct {
+	key1, key2, iv []byte
+}
 
 func (a *AesCbc) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, aes.BlockSize)
 
-	block1, err := aes.NewCipher(aesCbcKey1)
+	block1, err := aes.NewCipher(orDefault(a.key1, aesCbcKey1))
 	if err != nil {
 		return nil, err
 	}
 	cipher1 := make([]byte, len(padded))
-	cipher.NewCBCEncrypter(block1, aesCbcIv).CryptBlocks(cipher1, padded)
+	cipher.NewCBCEncrypter(block1, orDefault(a.iv, aesCbcIv)).CryptBlocks(cipher1, padded)
 
-	r1 := append(aesCbcIv, cipher1...)
+	r1 := append(orDefault(a.iv, aesCbcIv), cipher1...)
 
-	block2, err := aes.NewCipher(aesCbcKey2)
+	block2, err := aes.NewCipher(orDefault(a.key2, aesCbcKey2))
 	if err != nil {
 		return nil, err
 	}
 	cipher2 := make([]byte, len(r1))
-	cipher.NewCBCEncrypter(block2, aesCbcIv).CryptBlocks(cipher2, r1)
+	cipher.NewCBCEncrypter(block2, orDefault(a.iv, aesCbcIv)).CryptBlocks(cipher2, r1)
 
-	final := append(aesCbcIv, cipher2...)
+	final := append(orDefault(a.iv, aesCbcIv), cipher2...)
 	return encodeHexUpper(final), nil
 }
 
@@ -171,7 +311,7 @@ func (a *AesCbc) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidDataLength
 	}
 
-	block2, err := aes.NewCipher(aesCbcKey2)
+	block2, err := aes.NewCipher(orDefault(a.key2, aesCbcKey2))
 	if err != nil {
 		return nil, err
 	}
@@ -179,13 +319,13 @@ func (a *AesCbc) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 	decrypted1 := make([]byte, len(ciphertext)-aes.BlockSize)
-	cipher.NewCBCDecrypter(block2, aesCbcIv).CryptBlocks(decrypted1, ciphertext[aes.BlockSize:])
+	cipher.NewCBCDecrypter(block2, orDefault(a.iv, aesCbcIv)).CryptBlocks(decrypted1, ciphertext[aes.BlockSize:])
 
 	if len(decrypted1) < aes.BlockSize {
 		return nil, ErrInvalidDataLength
 	}
 
-	block1, err := aes.NewCipher(aesCbcKey1)
+	block1, err := aes.NewCipher(orDefault(a.key1, aesCbcKey1))
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +333,7 @@ func (a *AesCbc) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 	decrypted2 := make([]byte, len(decrypted1)-aes.BlockSize)
-	cipher.NewCBCDecrypter(block1, aesCbcIv).CryptBlocks(decrypted2, decrypted1[aes.BlockSize:])
+	cipher.NewCBCDecrypter(block1, orDefault(a.iv, aesCbcIv)).CryptBlocks(decrypted2, decrypted1[aes.BlockSize:])
 
 	return zeroUnpadding(decrypted2), nil
 }
@@ -203,19 +343,21 @@ var (
 	aesEcbKey2 = []byte{0x72, 0x6E, 0x25, 0x41, 0x45, 0x2F, 0x41, 0x54, 0x27, 0x4B, 0x3B, 0x3B, 0x59, 0x25, 0x52, 0x24}
 )
 
-type AesEcb struct{}
+type AesEcb struct {
+	key1, key2 []byte
+}
 
 func (a *AesEcb) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, aes.BlockSize)
 
-	block1, err := aes.NewCipher(aesEcbKey1)
+	block1, err := aes.NewCipher(orDefault(a.key1, aesEcbKey1))
 	if err != nil {
 		return nil, err
 	}
 	encrypted1 := make([]byte, len(padded))
 	NewECBEncrypter(block1).CryptBlocks(encrypted1, padded)
 
-	block2, err := aes.NewCipher(aesEcbKey2)
+	block2, err := aes.NewCipher(orDefault(a.key2, aesEcbKey2))
 	if err != nil {
 		return nil, err
 	}
@@ -234,14 +376,14 @@ func (a *AesEcb) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 
-	block2, err := aes.NewCipher(aesEcbKey2)
+	block2, err := aes.NewCipher(orDefault(a.key2, aesEcbKey2))
 	if err != nil {
 		return nil, err
 	}
 	decrypted1 := make([]byte, len(ciphertext))
 	NewECBDecrypter(block2).CryptBlocks(decrypted1, ciphertext)
 
-	block1, err := aes.NewCipher(aesEcbKey1)
+	block1, err := aes.NewCipher(orDefault(a.key1, aesEcbKey1))
 	if err != nil {
 		return nil, err
 	}
@@ -257,24 +399,26 @@ var (
 	desEdeCbcIv   = []byte{0x77, 0x2D, 0x56, 0x51, 0x28, 0x49, 0x7E, 0x57}
 )
 
-type DesEdeCbc struct{}
+type DesEdeCbc struct {
+	key1, key2, iv []byte
+}
 
 func (d *DesEdeCbc) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, des.BlockSize)
 
-	block1, err := des.NewTripleDESCipher(desEdeCbcKey1)
+	block1, err := des.NewTripleDESCipher(orDefault(d.key1, desEdeCbcKey1))
 	if err != nil {
 		return nil, err
 	}
 	encrypted1 := make([]byte, len(padded))
-	cipher.NewCBCEncrypter(block1, desEdeCbcIv).CryptBlocks(encrypted1, padded)
+	cipher.NewCBCEncrypter(block1, orDefault(d.iv, desEdeCbcIv)).CryptBlocks(encrypted1, padded)
 
-	block2, err := des.NewTripleDESCipher(desEdeCbcKey2)
+	block2, err := des.NewTripleDESCipher(orDefault(d.key2, desEdeCbcKey2))
 	if err != nil {
 		return nil, err
 	}
 	encrypted2 := make([]byte, len(encrypted1))
-	cipher.NewCBCEncrypter(block2, desEdeCbcIv).CryptBlocks(encrypted2, encrypted1)
+	cipher.NewCBCEncrypter(block2, orDefault(d.iv, desEdeCbcIv)).CryptBlocks(encrypted2, encrypted1)
 
 	return encodeHexUpper(encrypted2), nil
 }
@@ -288,19 +432,19 @@ func (d *DesEdeCbc) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 
-	block2, err := des.NewTripleDESCipher(desEdeCbcKey2)
+	block2, err := des.NewTripleDESCipher(orDefault(d.key2, desEdeCbcKey2))
 	if err != nil {
 		return nil, err
 	}
 	decrypted1 := make([]byte, len(ciphertext))
-	cipher.NewCBCDecrypter(block2, desEdeCbcIv).CryptBlocks(decrypted1, ciphertext)
+	cipher.NewCBCDecrypter(block2, orDefault(d.iv, desEdeCbcIv)).CryptBlocks(decrypted1, ciphertext)
 
-	block1, err := des.NewTripleDESCipher(desEdeCbcKey1)
+	block1, err := des.NewTripleDESCipher(orDefault(d.key1, desEdeCbcKey1))
 	if err != nil {
 		return nil, err
 	}
 	decrypted2 := make([]byte, len(decrypted1))
-	cipher.NewCBCDecrypter(block1, desEdeCbcIv).CryptBlocks(decrypted2, decrypted1)
+	cipher.NewCBCDecrypter(block1, orDefault(d.iv, desEdeCbcIv)).CryptBlocks(decrypted2, decrypted1)
 
 	return zeroUnpadding(decrypted2), nil
 }
@@ -310,19 +454,21 @@ var (
 	desEdeEcbKey2 = []byte{0x59, 0x28, 0x5B, 0x7E, 0x7D, 0x26, 0x74, 0x49, 0x48, 0x76, 0x59, 0x58, 0x62, 0x75, 0x51, 0x55, 0x26, 0x73, 0x55, 0x5C, 0x67, 0x52, 0x2E, 0x6C}
 )
 
-type DesEdeEcb struct{}
+type DesEdeEcb struct {
+	key1, key2 []byte
+}
 
 func (d *DesEdeEcb) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, des.BlockSize)
 
-	block1, err := des.NewTripleDESCipher(desEdeEcbKey1)
+	block1, err := des.NewTripleDESCipher(orDefault(d.key1, desEdeEcbKey1))
 	if err != nil {
 		return nil, err
 	}
 	encrypted1 := make([]byte, len(padded))
 	NewECBEncrypter(block1).CryptBlocks(encrypted1, padded)
 
-	block2, err := des.NewTripleDESCipher(desEdeEcbKey2)
+	block2, err := des.NewTripleDESCipher(orDefault(d.key2, desEdeEcbKey2))
 	if err != nil {
 		return nil, err
 	}
@@ -341,14 +487,14 @@ func (d *DesEdeEcb) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 
-	block2, err := des.NewTripleDESCipher(desEdeEcbKey2)
+	block2, err := des.NewTripleDESCipher(orDefault(d.key2, desEdeEcbKey2))
 	if err != nil {
 		return nil, err
 	}
 	decrypted1 := make([]byte, len(ciphertext))
 	NewECBDecrypter(block2).CryptBlocks(decrypted1, ciphertext)
 
-	block1, err := des.NewTripleDESCipher(desEdeEcbKey1)
+	block1, err := des.NewTripleDESCipher(orDefault(d.key1, desEdeEcbKey1))
 	if err != nil {
 		return nil, err
 	}
@@ -363,16 +509,18 @@ var (
 	sm4CbcIv  = []byte{0x68, 0x3c, 0x42, 0x51, 0x5a, 0x46, 0x3a, 0x52, 0x67, 0x77, 0x7e, 0x6e, 0x69, 0x70, 0x48, 0x5e}
 )
 
-type Sm4Cbc struct{}
+type Sm4Cbc struct {
+	key, iv []byte
+}
 
 func (s *Sm4Cbc) Encrypt(data []byte) ([]byte, error) {
-	block, err := sm4.NewCipher(sm4CbcKey)
+	block, err := sm4.NewCipher(orDefault(s.key, sm4CbcKey))
 	if err != nil {
 		return nil, err
 	}
 	padded := pkcs7Padding(data, block.BlockSize())
 	encrypted := make([]byte, len(padded))
-	cipher.NewCBCEncrypter(block, sm4CbcIv).CryptBlocks(encrypted, padded)
+	cipher.NewCBCEncrypter(block, orDefault(s.iv, sm4CbcIv)).CryptBlocks(encrypted, padded)
 	return encodeHexUpper(encrypted), nil
 }
 
@@ -381,7 +529,7 @@ func (s *Sm4Cbc) Decrypt(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	block, err := sm4.NewCipher(sm4CbcKey)
+	block, err := sm4.NewCipher(orDefault(s.key, sm4CbcKey))
 	if err != nil {
 		return nil, err
 	}
@@ -389,16 +537,18 @@ func (s *Sm4Cbc) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 	decrypted := make([]byte, len(ciphertext))
-	cipher.NewCBCDecrypter(block, sm4CbcIv).CryptBlocks(decrypted, ciphertext)
+	cipher.NewCBCDecrypter(block, orDefault(s.iv, sm4CbcIv)).CryptBlocks(decrypted, ciphertext)
 	return pkcs7Unpadding(decrypted, block.BlockSize())
 }
 
 var sm4EcbKey = []byte{0x53, 0x2f, 0x79, 0x4a, 0x4e, 0x79, 0x74, 0x4d, 0x67, 0x66, 0x57, 0x5a, 0x2d, 0x44, 0x5c, 0x57}
 
-type Sm4Ecb struct{}
+type Sm4Ecb struct {
+	key []byte
+}
 
 func (s *Sm4Ecb) Encrypt(data []byte) ([]byte, error) {
-	block, err := sm4.NewCipher(sm4EcbKey)
+	block, err := sm4.NewCipher(orDefault(s.key, sm4EcbKey))
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +563,7 @@ func (s *Sm4Ecb) Decrypt(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	block, err := sm4.NewCipher(sm4EcbKey)
+	block, err := sm4.NewCipher(orDefault(s.key, sm4EcbKey))
 	if err != nil {
 		return nil, err
 	}
@@ -431,7 +581,9 @@ var (
 	xteaKey3 = []uint32{0x5b5a683d, 0x2e572a77, 0x4a474465, 0x663d7e5c}
 )
 
-type XTea struct{}
+type XTea struct {
+	key1, key2, key3 []uint32
+}
 
 func (x *XTea) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, 8)
@@ -439,9 +591,9 @@ func (x *XTea) Encrypt(data []byte) ([]byte, error) {
 	for i := 0; i < len(padded); i += 8 {
 		v0 := binary.BigEndian.Uint32(padded[i : i+4])
 		v1 := binary.BigEndian.Uint32(padded[i+4 : i+8])
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaKey1)
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaKey2)
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaKey3)
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key1, xteaKey1))
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key2, xteaKey2))
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key3, xteaKey3))
 		binary.BigEndian.PutUint32(encrypted[i:], v0)
 		binary.BigEndian.PutUint32(encrypted[i+4:], v1)
 	}
@@ -460,9 +612,9 @@ func (x *XTea) Decrypt(data []byte) ([]byte, error) {
 	for i := 0; i < len(ciphertext); i += 8 {
 		v0 := binary.BigEndian.Uint32(ciphertext[i : i+4])
 		v1 := binary.BigEndian.Uint32(ciphertext[i+4 : i+8])
-		v0, v1 = decryptXTeaBlock(v0, v1, xteaKey3)
-		v0, v1 = decryptXTeaBlock(v0, v1, xteaKey2)
-		v0, v1 = decryptXTeaBlock(v0, v1, xteaKey1)
+		v0, v1 = decryptXTeaBlock(v0, v1, orDefault(x.key3, xteaKey3))
+		v0, v1 = decryptXTeaBlock(v0, v1, orDefault(x.key2, xteaKey2))
+		v0, v1 = decryptXTeaBlock(v0, v1, orDefault(x.key1, xteaKey1))
 		binary.BigEndian.PutUint32(decrypted[i:], v0)
 		binary.BigEndian.PutUint32(decrypted[i+4:], v1)
 	}
@@ -476,18 +628,21 @@ var (
 	xteaIv     = []uint32{0x544c2f3f, 0x6f485121}
 )
 
-type XTeaIv struct{}
+type XTeaIv struct {
+	key1, key2, key3, iv []uint32
+}
 
 func (x *XTeaIv) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, 8)
 	encrypted := make([]byte, len(padded))
-	prevV0, prevV1 := xteaIv[0], xteaIv[1]
+	iv := orDefault(x.iv, xteaIv)
+	prevV0, prevV1 := iv[0], iv[1]
 	for i := 0; i < len(padded); i += 8 {
 		v0 := binary.BigEndian.Uint32(padded[i:]) ^ prevV0
 		v1 := binary.BigEndian.Uint32(padded[i+4:]) ^ prevV1
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaIvKey3)
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaIvKey2)
-		v0, v1 = encryptXTeaBlock(v0, v1, xteaIvKey1)
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key3, xteaIvKey3))
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key2, xteaIvKey2))
+		v0, v1 = encryptXTeaBlock(v0, v1, orDefault(x.key1, xteaIvKey1))
 		binary.BigEndian.PutUint32(encrypted[i:], v0)
 		binary.BigEndian.PutUint32(encrypted[i+4:], v1)
 		prevV0, prevV1 = v0, v1
@@ -504,13 +659,14 @@ func (x *XTeaIv) Decrypt(data []byte) ([]byte, error) {
 		return nil, ErrInvalidCiphertextLength
 	}
 	decrypted := make([]byte, len(ciphertext))
-	prevV0, prevV1 := xteaIv[0], xteaIv[1]
+	iv := orDefault(x.iv, xteaIv)
+	prevV0, prevV1 := iv[0], iv[1]
 	for i := 0; i < len(ciphertext); i += 8 {
 		v0 := binary.BigEndian.Uint32(ciphertext[i:])
 		v1 := binary.BigEndian.Uint32(ciphertext[i+4:])
-		r0, r1 := decryptXTeaBlock(v0, v1, xteaIvKey1)
-		r0, r1 = decryptXTeaBlock(r0, r1, xteaIvKey2)
-		r0, r1 = decryptXTeaBlock(r0, r1, xteaIvKey3)
+		r0, r1 := decryptXTeaBlock(v0, v1, orDefault(x.key1, xteaIvKey1))
+		r0, r1 = decryptXTeaBlock(r0, r1, orDefault(x.key2, xteaIvKey2))
+		r0, r1 = decryptXTeaBlock(r0, r1, orDefault(x.key3, xteaIvKey3))
 		binary.BigEndian.PutUint32(decrypted[i:], r0^prevV0)
 		binary.BigEndian.PutUint32(decrypted[i+4:], r1^prevV1)
 		prevV0, prevV1 = v0, v1
@@ -547,16 +703,20 @@ var (
 	zucIv  = []byte{0x41, 0x3c, 0x7a, 0x55, 0x4a, 0x21, 0x48, 0x3d, 0x5d, 0x2d, 0x24, 0x45, 0x45, 0x3c, 0x57, 0x79}
 )
 
-type Zuc struct{}
+type Zuc struct {
+	key, iv []byte
+}
 
 func (z *Zuc) Encrypt(data []byte) ([]byte, error) {
 	padded := zeroPadding(data, 4) // ZUC works on 32-bit words
-	c, err := zuc.NewCipher(zucKey, zucIv)
+	c, err := zuc.NewCipher(orDefault(z.key, zucKey), orDefault(z.iv, zucIv))
 	if err != nil {
 		return nil, err
 	}
-	c.XORKeyStream(padded, padded)
-	return encodeHexUpper(padded), nil
+	//padded is data itself when already aligned, never overwrite the caller's plaintext
+	encrypted := make([]byte, len(padded))
+	c.XORKeyStream(encrypted, padded)
+	return encodeHexUpper(encrypted), nil
 }
 
 func (z *Zuc) Decrypt(data []byte) ([]byte, error) {
@@ -564,7 +724,7 @@ func (z *Zuc) Decrypt(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	c, err := zuc.NewCipher(zucKey, zucIv)
+	c, err := zuc.NewCipher(orDefault(z.key, zucKey), orDefault(z.iv, zucIv))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,173 @@
+package cipher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"testing"
+)
+
+// snapshot is a plaintext/ciphertext pair recorded from this implementation.
+// testdata/snapshots.json holds pairs for every algo ID with the built-in
+// keys and with portal-supplied key material. They only guard against
+// regressions, they are not known answers: no pairs captured from the
+// official client exist yet. reference_test.go checks the algorithms against
+// independent implementations instead.
+type snapshot struct {
+	AlgoID string `json:"algo_id"`
+	// Key is hex encoded key material, empty for the built-in keys.
+	Key        string `json:"key,omitempty"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+func loadSnapshots(tb testing.TB) []snapshot {
+	tb.Helper()
+	data, err := os.ReadFile("testdata/snapshots.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var snapshots []snapshot
+	if err = json.Unmarshal(data, &snapshots); err != nil {
+		tb.Fatal(err)
+	}
+	return snapshots
+}
+
+func TestSnapshots(t *testing.T) {
+	byAlgo := map[string][]snapshot{}
+	for _, v := range loadSnapshots(t) {
+		byAlgo[v.AlgoID] = append(byAlgo[v.AlgoID], v)
+	}
+
+	for _, algoID := range AlgoIDs() {
+		t.Run(Name(algoID), func(t *testing.T) {
+			if len(byAlgo[algoID]) == 0 {
+				t.Fatal("no snapshots")
+			}
+			for _, v := range byAlgo[algoID] {
+				key, err := hex.DecodeString(v.Key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c, err := NewCipherWithKey(v.AlgoID, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				plain := []byte(v.Plaintext)
+				enc, err := c.Encrypt(plain)
+				if err != nil {
+					t.Fatalf("encrypt %q: %v", v.Plaintext, err)
+				}
+				if string(plain) != v.Plaintext {
+					t.Fatalf("encrypt %q modified its input", v.Plaintext)
+				}
+				if string(enc) != v.Ciphertext {
+					t.Errorf("encrypt %q with key %q: got %s, want %s", v.Plaintext, v.Key, enc, v.Ciphertext)
+				}
+
+				dec, err := c.Decrypt([]byte(v.Ciphertext))
+				if err != nil {
+					t.Fatalf("decrypt %s: %v", v.Ciphertext, err)
+				}
+				if string(dec) != v.Plaintext {
+					t.Errorf("decrypt %s with key %q: got %q, want %q", v.Ciphertext, v.Key, dec, v.Plaintext)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, algoID := range AlgoIDs() {
+		t.Run(Name(algoID), func(t *testing.T) {
+			key := make([]byte, KeySize(algoID))
+			for _, k := range [][]byte{nil, key} {
+				for i := range k {
+					k[i] = byte(rand.IntN(256))
+				}
+				c, err := NewCipherWithKey(algoID, k)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for n := 0; n <= 64; n++ {
+					plain := make([]byte, n)
+					for i := range plain {
+						//zero padded ciphers can not tell trailing zeros from padding
+						plain[i] = byte(1 + rand.IntN(255))
+					}
+					orig := bytes.Clone(plain)
+
+					enc, err := c.Encrypt(plain)
+					if err != nil {
+						t.Fatalf("encrypt %d bytes: %v", n, err)
+					}
+					if !bytes.Equal(plain, orig) {
+						t.Fatalf("encrypt %d bytes modified its input", n)
+					}
+					dec, err := c.Decrypt(enc)
+					if err != nil {
+						t.Fatalf("decrypt %d bytes: %v", n, err)
+					}
+					if !bytes.Equal(dec, orig) {
+						t.Fatalf("round trip of %d bytes: got %x, want %x", n, dec, orig)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestMalformed feeds ciphertext no portal would send and expects an error
+// or garbage, never a panic.
+func TestMalformed(t *testing.T) {
+	for _, algoID := range AlgoIDs() {
+		t.Run(Name(algoID), func(t *testing.T) {
+			c := NewCipher(algoID)
+			for _, data := range []string{"", "0", "ZZ", "00", "0011223344", "00112233445566778899AABBCCDDEEFF00"} {
+				_, _ = c.Decrypt([]byte(data))
+			}
+		})
+	}
+}
+
+func TestPadding(t *testing.T) {
+	const blockSize = 16
+	for n := 0; n <= 2*blockSize; n++ {
+		data := bytes.Repeat([]byte{'x'}, n)
+		padded := pkcs7Padding(bytes.Clone(data), blockSize)
+		if len(padded)%blockSize != 0 || len(padded) == n {
+			t.Fatalf("pkcs7 padding of %d bytes has length %d", n, len(padded))
+		}
+		unpadded, err := pkcs7Unpadding(padded, blockSize)
+		if err != nil || !bytes.Equal(unpadded, data) {
+			t.Fatalf("pkcs7 round trip of %d bytes: got %q, %v", n, unpadded, err)
+		}
+
+		padded = zeroPadding(bytes.Clone(data), blockSize)
+		if len(padded)%blockSize != 0 || !bytes.Equal(zeroUnpadding(padded), data) {
+			t.Fatalf("zero padding round trip of %d bytes failed", n)
+		}
+	}
+
+	for _, bad := range [][]byte{
+		{},
+		bytes.Repeat([]byte{0}, blockSize),
+		bytes.Repeat([]byte{blockSize + 1}, blockSize),
+		append(bytes.Repeat([]byte{'x'}, blockSize-2), 1, 2),
+		{4, 4, 4},
+	} {
+		if _, err := pkcs7Unpadding(bad, blockSize); !errors.Is(err, ErrInvalidPadding) {
+			t.Errorf("pkcs7 unpadding accepted %x", bad)
+		}
+	}
+
+	if got := zeroUnpadding(make([]byte, blockSize)); len(got) != 0 {
+		t.Errorf("zero unpadding of zeros left %x", got)
+	}
+}
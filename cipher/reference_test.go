@@ -0,0 +1,252 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/emmansun/gmsm/sm4"
+	"github.com/emmansun/gmsm/zuc"
+	"golang.org/x/crypto/xtea"
+)
+
+// reference encrypts plain the way an algorithm is specified, from the
+// standard block ciphers and modes rather than from this package. parts are
+// the keys and IV in the order of the algorithm's key material.
+type reference func(tb testing.TB, parts [][]byte, plain []byte) []byte
+
+var references = map[string]reference{
+	AlgoAesCbc: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		key1, key2, iv := parts[0], parts[1], parts[2]
+		inner := append(bytes.Clone(iv), cbcEncrypt(tb, newAES(tb, key1), iv, zeroPad(plain, aes.BlockSize))...)
+		return append(bytes.Clone(iv), cbcEncrypt(tb, newAES(tb, key2), iv, inner)...)
+	},
+	AlgoAesEcb: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		return ecbEncrypt(layered{newAES(tb, parts[0]), newAES(tb, parts[1])}, zeroPad(plain, aes.BlockSize))
+	},
+	AlgoDesEdeCbc: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		key1, key2, iv := parts[0], parts[1], parts[2]
+		inner := cbcEncrypt(tb, newTripleDES(tb, key1), iv, zeroPad(plain, des.BlockSize))
+		return cbcEncrypt(tb, newTripleDES(tb, key2), iv, inner)
+	},
+	AlgoDesEdeEcb: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		return ecbEncrypt(layered{newTripleDES(tb, parts[0]), newTripleDES(tb, parts[1])}, zeroPad(plain, des.BlockSize))
+	},
+	AlgoSm4Cbc: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		return cbcEncrypt(tb, newSM4(tb, parts[0]), parts[1], pkcs7Pad(plain, sm4.BlockSize))
+	},
+	AlgoSm4Ecb: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		return ecbEncrypt(newSM4(tb, parts[0]), pkcs7Pad(plain, sm4.BlockSize))
+	},
+	AlgoZUC: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		stream, err := zuc.NewCipher(parts[0], parts[1])
+		if err != nil {
+			tb.Fatal(err)
+		}
+		padded := zeroPad(plain, 4)
+		out := make([]byte, len(padded))
+		stream.XORKeyStream(out, padded)
+		return out
+	},
+	AlgoXTea: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		return ecbEncrypt(layered{newXTEA(tb, parts[0]), newXTEA(tb, parts[1]), newXTEA(tb, parts[2])}, zeroPad(plain, xtea.BlockSize))
+	},
+	AlgoXTeaIv: func(tb testing.TB, parts [][]byte, plain []byte) []byte {
+		//the keys are applied last to first, the IV chains like plain CBC
+		block := layered{newXTEA(tb, parts[2]), newXTEA(tb, parts[1]), newXTEA(tb, parts[0])}
+		return cbcEncrypt(tb, block, parts[3], zeroPad(plain, xtea.BlockSize))
+	},
+}
+
+// builtInParts are the built-in keys as key material parts.
+var builtInParts = map[string][][]byte{
+	AlgoAesCbc:    {aesCbcKey1, aesCbcKey2, aesCbcIv},
+	AlgoAesEcb:    {aesEcbKey1, aesEcbKey2},
+	AlgoDesEdeCbc: {desEdeCbcKey1, desEdeCbcKey2, desEdeCbcIv},
+	AlgoDesEdeEcb: {desEdeEcbKey1, desEdeEcbKey2},
+	AlgoSm4Cbc:    {sm4CbcKey, sm4CbcIv},
+	AlgoSm4Ecb:    {sm4EcbKey},
+	AlgoZUC:       {zucKey, zucIv},
+	AlgoXTea:      {wordBytes(xteaKey1), wordBytes(xteaKey2), wordBytes(xteaKey3)},
+	AlgoXTeaIv:    {wordBytes(xteaIvKey1), wordBytes(xteaIvKey2), wordBytes(xteaIvKey3), wordBytes(xteaIv)},
+}
+
+// TestReference compares every algorithm, with the built-in keys and with
+// random key material, against its reference composition.
+func TestReference(t *testing.T) {
+	for _, algoID := range AlgoIDs() {
+		t.Run(Name(algoID), func(t *testing.T) {
+			ref, ok := references[algoID]
+			if !ok {
+				t.Fatal("no reference")
+			}
+
+			random := make([][]byte, len(cipherRegistry[algoID].keySizes))
+			for i, size := range cipherRegistry[algoID].keySizes {
+				random[i] = make([]byte, size)
+				for j := range random[i] {
+					random[i][j] = byte(rand.IntN(256))
+				}
+			}
+
+			keys := []struct {
+				parts [][]byte
+				//material is what NewCipherWithKey gets, nil selects the built-in keys
+				material []byte
+			}{
+				{builtInParts[algoID], nil},
+				{random, bytes.Join(random, nil)},
+			}
+			for _, k := range keys {
+				parts, material := k.parts, k.material
+				c, err := NewCipherWithKey(algoID, material)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for n := 0; n <= 64; n++ {
+					plain := make([]byte, n)
+					for i := range plain {
+						//zero padded ciphers can not tell trailing zeros from padding
+						plain[i] = byte(1 + rand.IntN(255))
+					}
+					want := strings.ToUpper(hex.EncodeToString(ref(t, parts, plain)))
+
+					got, err := c.Encrypt(bytes.Clone(plain))
+					if err != nil {
+						t.Fatalf("encrypt %d bytes: %v", n, err)
+					}
+					if string(got) != want {
+						t.Fatalf("encrypt %x with key %x:\n got %s\nwant %s", plain, material, got, want)
+					}
+					dec, err := c.Decrypt([]byte(want))
+					if err != nil {
+						t.Fatalf("decrypt %s: %v", want, err)
+					}
+					if !bytes.Equal(dec, plain) {
+						t.Fatalf("decrypt %s: got %x, want %x", want, dec, plain)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestStandardVectors checks the SM4 and ZUC primitives, which have no
+// implementation in the standard library, against the examples published
+// with GB/T 32907-2016 and the ZUC specification.
+func TestStandardVectors(t *testing.T) {
+	t.Run("sm4", func(t *testing.T) {
+		key, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+		out := make([]byte, sm4.BlockSize)
+		newSM4(t, key).Encrypt(out, key)
+		if got := hex.EncodeToString(out); got != "681edf34d206965e86b3e94f536e4246" {
+			t.Fatalf("got %s", got)
+		}
+	})
+	t.Run("zuc", func(t *testing.T) {
+		stream, err := zuc.NewCipher(make([]byte, 16), make([]byte, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, 8)
+		stream.XORKeyStream(out, out)
+		if got := hex.EncodeToString(out); got != "27bede74018082da" {
+			t.Fatalf("got %s", got)
+		}
+	})
+}
+
+// layered applies its blocks one after another, as one block.
+type layered []cipher.Block
+
+func (l layered) BlockSize() int { return l[0].BlockSize() }
+
+func (l layered) Encrypt(dst, src []byte) {
+	copy(dst, src)
+	for _, b := range l {
+		b.Encrypt(dst, dst)
+	}
+}
+
+func (l layered) Decrypt(dst, src []byte) {
+	copy(dst, src)
+	for i := len(l) - 1; i >= 0; i-- {
+		l[i].Decrypt(dst, dst)
+	}
+}
+
+func ecbEncrypt(b cipher.Block, plain []byte) []byte {
+	out := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += b.BlockSize() {
+		b.Encrypt(out[i:], plain[i:])
+	}
+	return out
+}
+
+func cbcEncrypt(tb testing.TB, b cipher.Block, iv, plain []byte) []byte {
+	if len(iv) != b.BlockSize() {
+		tb.Fatalf("iv of %d bytes for a %d byte block", len(iv), b.BlockSize())
+	}
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(b, iv).CryptBlocks(out, plain)
+	return out
+}
+
+func zeroPad(data []byte, blockSize int) []byte {
+	n := (len(data) + blockSize - 1) / blockSize * blockSize
+	out := make([]byte, n)
+	copy(out, data)
+	return out
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	return append(bytes.Clone(data), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func wordBytes(w []uint32) []byte {
+	out := make([]byte, 4*len(w))
+	for i, v := range w {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+func newAES(tb testing.TB, key []byte) cipher.Block {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func newTripleDES(tb testing.TB, key []byte) cipher.Block {
+	b, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func newSM4(tb testing.TB, key []byte) cipher.Block {
+	b, err := sm4.NewCipher(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func newXTEA(tb testing.TB, key []byte) cipher.Block {
+	b, err := xtea.NewCipher(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
@@ -1,31 +1,59 @@
-package main
+package esurfing
 
 import (
 	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"math"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+	"github.com/DreamwareN/Esurfing-go/trace"
+	"github.com/DreamwareN/Esurfing-go/transport"
 	"github.com/google/uuid"
 )
 
 type Client struct {
-	Config          *Config
-	Log             *log.Logger
-	HttpClient      *http.Client
-	Ctx             context.Context
-	Cancel          context.CancelFunc
-	cipher          Cipher
+	Config *Config
+	// rawConfig is Config as given, before NewClient filled in defaults.
+	rawConfig  Config
+	Log        *slog.Logger
+	HttpClient *http.Client
+	// IPv6Client runs the IPv6 probe, nil when Config.IPv6Probe is empty.
+	IPv6Client *http.Client
+	Ctx        context.Context
+	Cancel     context.CancelFunc
+	// Trace, if set, records every exchange once Start wraps the transport.
+	Trace *trace.Recorder
+	// Profile is the client fingerprint sent in headers and request bodies.
+	Profile         protocol.Profile
+	cipher          cipher.Cipher
 	heartBeatTicker *time.Ticker
+	ipv6Checked     bool
+	//last IPv4 address seen on the bound interface, empty while it has none
+	bindIP      string
+	bindChecked bool
+	//a saved session is still to be resumed, cleared once the portal answers
+	resuming    bool
+	probes      []Probe
+	probeQuorum int
+	backoff     *backoff
+	commands    chan commandRequest
+	done        chan struct{}
+
+	//guards status and metrics, everything else is owned by the Start goroutine
+	statusMu sync.Mutex
+	status   Status
+	metrics  Metrics
 
 	UserIP     string
+	UserIPv6   string
 	AcIP       string
 	Domain     string
 	Area       string
@@ -34,7 +62,12 @@ type Client struct {
 	Hostname   string
 	MacAddress string
 	Ticket     string
-	AlgoID     string
+	// TicketExpiry is when the portal said Ticket expires, zero if unknown.
+	TicketExpiry time.Time
+	Policy       Policy
+	AlgoID       string
+	//key material sent by the portal with AlgoID, empty for the built-in keys
+	AlgoKey []byte
 
 	IndexUrl    string
 	TicketUrl   string
@@ -45,13 +78,69 @@ type Client struct {
 }
 
 func NewClient(config *Config) (*Client, error) {
+	raw := *config
 	if config.Username == "" || config.Password == "" {
 		return nil, errors.New("username or password is empty")
 	}
+	if err := validateIdentity(config); err != nil {
+		return nil, err
+	}
+	profile, ok := protocol.LookupProfile(config.Profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, known: %s", config.Profile, strings.Join(protocol.ProfileNames(), ", "))
+	}
+	if config.UserAgent != "" {
+		profile.UserAgent = config.UserAgent
+	}
+	if config.Accept != "" {
+		profile.Accept = config.Accept
+	}
+	if config.Ostag != "" {
+		profile.Ostag = config.Ostag
+	}
+	if config.IPv6 != "" && config.IPv6 != IPv6Auto {
+		if ip := net.ParseIP(config.IPv6); ip == nil || ip.To4() != nil {
+			return nil, errors.New("invalid ipv6: " + config.IPv6)
+		}
+	}
 
-	transport, err := NewHttpTransport(config)
+	probes, probeQuorum, err := probeConfig(config)
 	if err != nil {
-		return nil, errors.New(fmt.Errorf("failed to create transport: %w", err).Error())
+		return nil, err
+	}
+
+	if config.Fwmark < 0 {
+		return nil, fmt.Errorf("invalid fwmark: %d", config.Fwmark)
+	}
+	if config.BindToDevice && (config.BindInterface == "" || config.BindInterface == "sys_default") {
+		return nil, errors.New("bind_to_device requires bind_interface")
+	}
+
+	options := transport.Options{
+		BindInterface: config.BindInterface,
+		DnsAddress:    config.DnsAddress,
+		Netns:         config.Netns,
+		Fwmark:        config.Fwmark,
+		BindToDevice:  config.BindToDevice,
+	}
+	if err = options.CheckSocketOptions(); err != nil {
+		return nil, err
+	}
+	//fails early on a missing namespace or missing privileges
+	if err = transport.InNetns(config.Netns, func() error { return nil }); err != nil {
+		return nil, err
+	}
+
+	httpTransport := transport.NewHttpTransport(options)
+
+	var IPv6Client *http.Client
+	if config.IPv6Probe != "" {
+		IPv6Client = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: transport.NewIPv6Transport(options),
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -67,131 +156,370 @@ func NewClient(config *Config) (*Client, error) {
 	if config.RetryInterval == 0 {
 		config.RetryInterval = 10000
 	}
-	if config.RetryInterval < 0 {
-		config.RetryInterval = math.MaxInt32
+	if config.RetryMaxInterval <= 0 {
+		config.RetryMaxInterval = 600000
+	}
+	if config.RetryMaxInterval < config.RetryInterval {
+		config.RetryMaxInterval = config.RetryInterval
+	}
+	if config.RetryMaxAttempts < 0 {
+		config.RetryMaxAttempts = 0
 	}
 
 	cl := &Client{
-		Config: config,
-		Ctx:    ctx,
-		Cancel: cancel,
+		Config:    config,
+		rawConfig: raw,
+		Ctx:       ctx,
+		Cancel:    cancel,
 		HttpClient: &http.Client{
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
-			Transport: transport,
+			Transport: httpTransport,
 		},
-		AlgoID: "00000000-0000-0000-0000-000000000000",
-		Log: log.New(
-			os.Stdout,
-			"["+rid+"][user:"+config.Username+" bind_device:"+config.BindInterface+"] ",
-			log.LstdFlags|log.Lmsgprefix,
+		AlgoID:      protocol.ZeroAlgoID,
+		Profile:     profile,
+		IPv6Client:  IPv6Client,
+		probes:      probes,
+		probeQuorum: probeQuorum,
+		Log: slog.Default().With(
+			"rid", rid,
+			"user", config.Username,
+			"interface", config.BindInterface,
 		),
-		heartBeatTicker: time.NewTicker(time.Duration(math.MaxInt32)),
+		heartBeatTicker: time.NewTicker(heartbeatDisabled),
+		backoff:         newBackoff(config),
+		commands:        make(chan commandRequest),
+		done:            make(chan struct{}),
+		status: Status{
+			Username:      config.Username,
+			BindInterface: config.BindInterface,
+			Phase:         PhaseStarting,
+		},
+		metrics: Metrics{
+			AuthAttempts: map[string]uint64{},
+			AuthFailures: map[string]uint64{},
+		},
+	}
+
+	if config.TraceDir != "" {
+		cl.Trace = trace.NewRecorder(config.TraceDir, config.Username)
 	}
 
 	return cl, nil
 }
 
 func (c *Client) Start() {
-	c.Log.Println("client start")
-	defer wg.Done()
+	c.Log.Info("client start")
+	defer close(c.done)
+	if c.Trace != nil {
+		c.HttpClient.Transport = c.Trace.Transport(c.HttpClient.Transport)
+		defer func() {
+			_ = c.Trace.Close()
+		}()
+	}
 	defer c.heartBeatTicker.Stop()
+	defer c.setPhase(PhaseStopped)
 	defer c.Logout()
 
-	if err := c.CheckNetwork(); err != nil {
-		c.Log.Printf("Network check failed:%v", err)
+	//armed only while waiting to retry a failed auth, the regular check is paused meanwhile
+	var retry <-chan time.Time
+	paused := false
+
+	check := func() bool {
+		retry = nil
+		if !c.interfaceReady() {
+			return true
+		}
+		if c.resuming {
+			resumed, err := c.resumeSession()
+			if resumed {
+				c.resuming = false
+				c.backoff.Reset()
+				c.setPhase(PhaseOnline)
+				return true
+			}
+			//on a transport error the check still runs, a redirect means a fresh login anyway
+			c.resuming = err != nil
+		}
+		err := c.CheckNetwork()
+		if err == nil {
+			c.backoff.Reset()
+			c.setPhase(PhaseOnline)
+			return true
+		}
+		c.Log.Warn("network check failed", "err", err)
+		c.setError(err)
+
+		var authErr *AuthError
+		if !errors.As(err, &authErr) {
+			c.setPhase(PhaseOffline)
+			return true
+		}
+		if IsPermanent(err) {
+			c.Log.Error("giving up, auth will not succeed on retry", "stage", authErr.Stage)
+			return false
+		}
+
+		delay, ok := c.backoff.Next()
+		if !ok {
+			c.Log.Error("giving up after failed auth attempts", "attempts", c.backoff.Attempts())
+			return false
+		}
+		c.Log.Info("retry auth", "delay", delay.Round(time.Millisecond), "attempt", c.backoff.Attempts())
+		retry = time.After(delay)
+		c.setPhase(PhaseWaitingRetry)
+		c.updateStatus(func(s *Status) {
+			s.NextRetry = time.Now().Add(delay)
+		})
+		return true
+	}
+
+	c.resuming = c.Config.StateFile != ""
+	if !check() {
+		return
 	}
 
 	ticker := time.NewTicker(time.Millisecond * time.Duration(c.Config.CheckInterval))
 	defer ticker.Stop()
 
+	//link and address events of the bound interface, nil when polling is all there is
+	var events <-chan struct{}
+	if name := c.bindInterface(); name != "" {
+		var err error
+		if events, err = transport.WatchInterface(c.Ctx, c.Config.Netns, name); err != nil {
+			c.Log.Debug("interface events unavailable, polling only", "err", err)
+		}
+	}
+	//events come in bursts, e.g. link up then address added, check once they settle
+	settle := time.NewTimer(heartbeatDisabled)
+	defer settle.Stop()
+
+	//rearmed whenever the ticket expiry changes
+	refresh := time.NewTimer(heartbeatDisabled)
+	defer refresh.Stop()
+	var refreshFor time.Time
+
 	for {
+		if !c.TicketExpiry.Equal(refreshFor) {
+			refreshFor = c.TicketExpiry
+			if refreshFor.IsZero() {
+				refresh.Reset(heartbeatDisabled)
+			} else {
+				refresh.Reset(time.Until(refreshAt(refreshFor, time.Now())))
+			}
+		}
+
 		select {
 		case <-c.Ctx.Done():
-			c.Log.Println("client context cancel")
+			c.Log.Info("client context cancel")
 			return
 		case <-ticker.C:
-			if err := c.CheckNetwork(); err != nil {
-				c.Log.Printf("Network check failed:%v", err)
+			if paused || retry != nil {
+				continue
+			}
+			if !check() {
+				return
+			}
+		case <-retry:
+			if !check() {
+				return
+			}
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			settle.Reset(interfaceSettle)
+		case <-settle.C:
+			if paused {
+				continue
+			}
+			c.Log.Info("interface changed, checking network")
+			if !check() {
+				return
+			}
+		case <-refresh.C:
+			if paused || retry != nil {
+				continue
+			}
+			c.Log.Info("ticket expires soon, refreshing", "expiry", c.TicketExpiry)
+			err := c.RefreshTicket()
+			if errors.Is(err, errNoRefreshURL) {
+				//the session still works until it expires, heartbeat failure handles that
+				c.Log.Info("can not refresh the ticket of this session, keeping it until it expires")
+				continue
+			}
+			if err != nil {
+				c.Log.Warn("ticket refresh failed, re-auth now", "err", err)
+				c.setError(err)
+				c.Terminate()
+				if !check() {
+					return
+				}
 			}
 		case <-c.heartBeatTicker.C:
 			err := c.SendHeartbeat()
-			if err != nil {
-				c.Log.Printf("send heartbeat error: %v", err)
+			c.updateMetrics(func(m *Metrics) {
+				if err != nil {
+					m.HeartbeatFailures++
+				} else {
+					m.HeartbeatSuccesses++
+				}
+			})
+			if errors.Is(err, ErrTicketExpired) {
+				c.Log.Warn("send heartbeat error, re-auth now", "err", err)
+				c.setError(err)
+				c.stopHeartbeat()
+				if !paused && retry == nil && !check() {
+					return
+				}
+			} else if err != nil {
+				c.Log.Warn("send heartbeat error", "err", err)
+				c.setError(err)
 			} else {
-				c.Log.Println("send heartbeat")
+				c.Log.Debug("send heartbeat")
+			}
+		case req := <-c.commands:
+			c.Log.Info("command", "command", req.command)
+			keepRunning := true
+			switch req.command {
+			case CommandCheck:
+				if !paused {
+					keepRunning = check()
+				}
+			case CommandReauth:
+				c.Terminate()
+				paused = false
+				keepRunning = check()
+			case CommandLogout:
+				c.Terminate()
+				paused, retry = true, nil
+				c.setPhase(PhasePaused)
+			case CommandPause:
+				paused, retry = true, nil
+				c.setPhase(PhasePaused)
+			case CommandResume:
+				paused = false
+				//a refresh skipped while paused is due now
+				refreshFor = time.Time{}
+				keepRunning = check()
+			}
+			close(req.done)
+			if !keepRunning {
+				return
 			}
 		}
 	}
 }
 
 func (c *Client) SendHeartbeat() error {
+	if c.cipher == nil {
+		return errors.New("no session to keep alive")
+	}
+
 	stateXML, err := c.GenerateStateXML()
 	if err != nil {
 		return errors.New(err.Error())
 	}
 
 	decrypted, err := c.PostXML(c.KeepUrl, stateXML)
+	if err != nil {
+		return errors.New(err.Error())
+	}
 
-	var stateResp StateResponse
+	var stateResp protocol.StateResponse
 	if err := xml.Unmarshal(decrypted, &stateResp); err != nil {
 		return errors.New(err.Error())
 	}
 
-	interval, err := strconv.Atoi(stateResp.Interval)
+	if err = portalResult(stateResp.Code, stateResp.Message); err != nil {
+		return err
+	}
+
+	interval, err := parseInterval(stateResp.Interval)
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
 
-	c.heartBeatTicker.Reset(time.Duration(interval) * time.Second)
+	c.applyLevel(stateResp.Level)
+	interval = c.limitInterval(interval)
+
+	c.scheduleHeartbeat(interval)
+	c.updateStatus(func(s *Status) {
+		s.LastHeartbeat = time.Now()
+	})
+	c.updateMetrics(func(m *Metrics) {
+		m.HeartbeatInterval = interval
+	})
 	return nil
 }
 
 func (c *Client) Logout() {
-	request, _ := c.NewGetRequest("http://connect.rom.miui.com/generate_204")
-	resp, _ := c.HttpClient.Do(request)
-	if resp.StatusCode == http.StatusNoContent && c.cipher != nil {
-		stateXML, _ := c.GenerateStateXML()
-		_, _ = c.PostXMLWithTimeout(c.TermUrl, stateXML)
-		c.Log.Println("log out request sent")
+	//client context is already canceled here, probe with a short deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if c.judgeProbes(c.runProbes(ctx)).online {
+		c.Terminate()
 	}
 }
 
-func (c *Client) CheckNetwork() error {
-	request, err := c.NewGetRequest("http://connect.rom.miui.com/generate_204")
-	if err != nil {
-		return errors.New(err.Error())
+// Terminate sends the term request for the current session, if any, and
+// forgets it. Unlike Logout it does not check connectivity first.
+func (c *Client) Terminate() {
+	if c.cipher == nil || c.TermUrl == "" {
+		return
 	}
 
-	resp, err := c.HttpClient.Do(request)
-	if err != nil {
-		return errors.New(err.Error())
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
+	stateXML, _ := c.GenerateStateXML()
+	_, _ = c.PostXMLWithTimeout(c.TermUrl, stateXML)
+	c.Log.Info("log out request sent")
+	c.clearSession()
+	c.resetSession()
+	c.syncStatus()
+	c.stopHeartbeat()
+}
+
+func (c *Client) CheckNetwork() error {
+	start := time.Now()
+	verdict := c.judgeProbes(c.runProbes(c.Ctx))
+
+	latency := time.Since(start)
+	c.updateMetrics(func(m *Metrics) {
+		m.ProbeLatency = latency
+		if verdict.online {
+			m.LastProbeSuccess = time.Now()
+		}
+	})
 
-	switch resp.StatusCode {
-	case http.StatusNoContent:
+	switch {
+	case verdict.online:
+		c.checkIPv6()
 		return nil
 
-	case http.StatusFound:
-		c.heartBeatTicker.Reset(time.Duration(math.MaxInt32))
-		c.Log.Println("auth required")
-		return c.HandleRedirect(resp)
+	case verdict.redirect != nil:
+		//the portal wants a login, whatever session was saved is gone
+		c.resuming = false
+		c.stopHeartbeat()
+		c.setPhase(PhaseAuthenticating)
+		c.Log.Info("auth required")
+		if c.Trace != nil {
+			c.Trace.StartSession()
+		}
+		return c.HandleRedirect(verdict.redirect)
 
 	default:
-		return errors.New(fmt.Sprintf("unexpected status code: %d", resp.StatusCode))
+		return verdict.err
 	}
 }
 
 func (c *Client) HandleRedirect(resp *http.Response) error {
 	if err := c.Auth(resp.Header.Get("Location")); err != nil {
-		c.Log.Printf("auth failed: %v", err)
-		return nil
+		return err
 	}
 
-	c.Log.Println("auth finished")
+	c.syncStatus()
+	c.Log.Info("auth finished")
 	return nil
 }
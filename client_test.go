@@ -0,0 +1,256 @@
+package esurfing_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/esurfingtest"
+)
+
+// newPortalClient returns a client talking to portal only. Username and
+// password are taken from the portal when config leaves them empty.
+func newPortalClient(t *testing.T, portal *esurfingtest.Portal, config esurfing.Config) *esurfing.Client {
+	t.Helper()
+	if config.Username == "" {
+		config.Username, config.Password = portal.Username, portal.Password
+	}
+	c, err := esurfing.NewClient(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HttpClient.Transport = portal
+	c.Log = slog.New(slog.DiscardHandler)
+	t.Cleanup(c.Cancel)
+	return c
+}
+
+// login runs a connectivity check against a portal that redirects, which
+// authenticates the client.
+func login(t *testing.T, c *esurfing.Client, portal *esurfingtest.Portal) {
+	t.Helper()
+	if err := c.CheckNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	if !portal.Online() {
+		t.Fatal("portal does not consider the client online after auth")
+	}
+}
+
+// TestPortal runs auth, heartbeat and logout for every algorithm, with the
+// built-in keys, with key material the client must ignore and with keys the
+// portal rotates on every negotiation.
+func TestPortal(t *testing.T) {
+	for _, algoID := range cipher.AlgoIDs() {
+		t.Run(cipher.Name(algoID), func(t *testing.T) {
+			t.Parallel()
+			tests := []struct {
+				name   string
+				setup  func(p *esurfingtest.Portal)
+				config esurfing.Config
+			}{
+				{name: "built-in keys"},
+				{name: "extra key", setup: func(p *esurfingtest.Portal) {
+					//fits the key layout, but the portal keeps using the built-in keys
+					p.ExtraKey = make([]byte, cipher.KeySize(algoID))
+				}},
+				{name: "rotate keys", setup: func(p *esurfingtest.Portal) {
+					p.RotateKeys = true
+				}, config: esurfing.Config{PortalKeys: true}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					t.Parallel()
+					portal := esurfingtest.NewPortal("user", "pass")
+					portal.AlgoIDs = []string{algoID}
+					if tt.setup != nil {
+						tt.setup(portal)
+					}
+					c := newPortalClient(t, portal, tt.config)
+
+					login(t, c, portal)
+					if c.AlgoID != algoID {
+						t.Fatalf("negotiated %s, portal offered %s", c.AlgoID, algoID)
+					}
+					if err := c.CheckNetwork(); err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SendHeartbeat(); err != nil {
+						t.Fatal(err)
+					}
+					c.Terminate()
+					if portal.Online() {
+						t.Fatal("portal still considers the client online after logout")
+					}
+
+					stats := portal.Stats()
+					if stats.Logins != 1 || stats.Heartbeats != 1 || stats.Logouts != 1 || stats.Failures != 0 {
+						t.Fatalf("portal stats %+v", stats)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestPortalKick(t *testing.T) {
+	portal := esurfingtest.NewPortal("user", "pass")
+	c := newPortalClient(t, portal, esurfing.Config{})
+	login(t, c, portal)
+
+	portal.Kick()
+	if err := c.SendHeartbeat(); !errors.Is(err, esurfing.ErrTicketExpired) {
+		t.Fatalf("heartbeat after kick: %v, want %v", err, esurfing.ErrTicketExpired)
+	}
+	login(t, c, portal)
+	if logins := portal.Stats().Logins; logins != 2 {
+		t.Fatalf("%d logins, want 2", logins)
+	}
+}
+
+func TestPortalTicketLifetime(t *testing.T) {
+	portal := esurfingtest.NewPortal("user", "pass")
+	portal.TicketLifetime = 600
+	c := newPortalClient(t, portal, esurfing.Config{})
+
+	before := time.Now()
+	login(t, c, portal)
+	lifetime := c.TicketExpiry.Sub(before)
+	if lifetime < 600*time.Second || lifetime > 601*time.Second {
+		t.Fatalf("ticket expires in %v, portal sent 600s", lifetime)
+	}
+
+	ticket := c.Ticket
+	if err := c.RefreshTicket(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Ticket == ticket {
+		t.Fatal("refresh kept the old ticket")
+	}
+	if err := c.SendHeartbeat(); err != nil {
+		t.Fatalf("heartbeat with the refreshed ticket: %v", err)
+	}
+	if stats := portal.Stats(); stats.Tickets != 2 || stats.AlgoIDs != 1 {
+		t.Fatalf("portal stats %+v, want a second ticket without a new negotiation", stats)
+	}
+}
+
+func TestPortalPolicy(t *testing.T) {
+	portal := esurfingtest.NewPortal("user", "pass")
+	portal.AgainstInterval = 5
+	portal.DomainConfig = "mock-domain"
+	portal.Level = 2
+	c := newPortalClient(t, portal, esurfing.Config{})
+
+	login(t, c, portal)
+	policy := c.Status().Policy
+	if policy.AgainstInterval != 5 || policy.DomainConfig != "mock-domain" {
+		t.Fatalf("policy after login %+v", policy)
+	}
+	//the heartbeat interval is capped at against-interval
+	if interval := c.Metrics().HeartbeatInterval; interval != 5*time.Second {
+		t.Fatalf("heartbeat interval %v, want 5s", interval)
+	}
+
+	if err := c.SendHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if level := c.Status().Policy.Level; level != 2 {
+		t.Fatalf("level %d after heartbeat, want 2", level)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	if _, err := esurfing.NewClient(&esurfing.Config{Username: "user", Password: "pass", Profile: "windows"}); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+
+	c, err := esurfing.NewClient(&esurfing.Config{
+		Username:  "user",
+		Password:  "pass",
+		Profile:   "android",
+		UserAgent: "CCTP/custom/1",
+		Accept:    "*/*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cancel()
+
+	req, err := c.NewGetRequest("http://portal.mock/index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("User-Agent"); got != "CCTP/custom/1" {
+		t.Errorf("User-Agent %q, want the override", got)
+	}
+	if got := req.Header.Get("Accept"); got != "*/*" {
+		t.Errorf("Accept %q, want the override", got)
+	}
+	//not overridden, taken from the profile
+	if got := c.Profile.FormatOstag("host"); got != "host" {
+		t.Errorf("ostag %q, want the android one", got)
+	}
+}
+
+// start runs c.Start and returns a channel closed when it returns.
+func start(c *esurfing.Client) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	return done
+}
+
+func TestStartRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		message string
+		// stops is whether the client gives up instead of retrying.
+		stops bool
+	}{
+		{"bad credentials", "1", "用户名或密码错误", true},
+		{"suspended", "2", "您的账号已欠费停机", true},
+		{"too many devices", "3", "在线终端数已达上限", false},
+		{"unknown", "4", "系统繁忙", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			portal := esurfingtest.NewPortal("user", "pass")
+			portal.RejectCode, portal.RejectMessage = tt.code, tt.message
+			c := newPortalClient(t, portal, esurfing.Config{RetryInterval: 10, RetryMaxInterval: 10})
+			done := start(c)
+
+			if tt.stops {
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("client keeps retrying a permanent error")
+				}
+				if failures := portal.Stats().Failures; failures != 1 {
+					t.Fatalf("%d login attempts, want 1", failures)
+				}
+				return
+			}
+
+			deadline := time.After(5 * time.Second)
+			for portal.Stats().Failures < 3 {
+				select {
+				case <-done:
+					t.Fatalf("client gave up on a temporary error: %s", c.Status().LastError)
+				case <-deadline:
+					t.Fatalf("%d login attempts, want retries", portal.Stats().Failures)
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+			c.Cancel()
+			<-done
+		})
+	}
+}
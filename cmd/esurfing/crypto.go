@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+)
+
+const cryptoUsage = `usage: esurfing crypto <command> [flags] [file]
+
+commands:
+  encrypt -algo <id|name> [-key hex]  encrypt plaintext into a hex body
+  decrypt -algo <id|name> [-key hex]  decrypt a hex body
+  decode-algoid [-hex]                decode the ticket URL's algo id response
+  list                                list the supported algorithms
+
+input is read from file, or stdin when no file is given`
+
+// runCrypto encrypts and decrypts portal payloads by hand, e.g. bodies
+// copied out of a packet capture.
+func runCrypto(args []string) error {
+	if len(args) == 0 {
+		return errors.New(cryptoUsage)
+	}
+
+	switch args[0] {
+	case "encrypt", "decrypt":
+		return runCipher(args[0], args[1:])
+	case "decode-algoid":
+		return runDecodeAlgoID(args[1:])
+	case "list":
+		for _, algoID := range cipher.AlgoIDs() {
+			fmt.Printf("%s  %s\n", algoID, cipher.Name(algoID))
+		}
+		return nil
+	default:
+		return errors.New(cryptoUsage)
+	}
+}
+
+func runCipher(command string, args []string) error {
+	flags := flag.NewFlagSet("crypto "+command, flag.ContinueOnError)
+	algo := flags.String("algo", "", "algo id or name, see crypto list")
+	key := flags.String("key", "", "key material sent with the algo id, hex; empty = built-in keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	algoID, ok := cipher.LookupAlgoID(*algo)
+	if !ok {
+		return fmt.Errorf("unknown algo %q, see esurfing crypto list", *algo)
+	}
+	keyMaterial, err := hex.DecodeString(*key)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	c, err := cipher.NewCipherWithKey(algoID, keyMaterial)
+	if err != nil {
+		return err
+	}
+
+	input, err := readInput(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	if command == "encrypt" {
+		out, err := c.Encrypt(input)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Println(string(out))
+		return err
+	}
+
+	//captures tend to carry a trailing newline or spaces between bytes
+	out, err := c.Decrypt(stripSpace(input))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func runDecodeAlgoID(args []string) error {
+	flags := flag.NewFlagSet("crypto decode-algoid", flag.ContinueOnError)
+	isHex := flags.Bool("hex", false, "input is a hex dump rather than the raw response body")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	input, err := readInput(flags.Args())
+	if err != nil {
+		return err
+	}
+	if *isHex {
+		if input, err = hex.DecodeString(string(stripSpace(input))); err != nil {
+			return err
+		}
+	}
+
+	algoID, key, err := protocol.DecodeAlgoID(input)
+	if err != nil {
+		return err
+	}
+	name := cipher.Name(algoID)
+	if name == "" {
+		name = "unknown"
+	}
+	fmt.Printf("algo_id: %s\nname:    %s\nkey:     %s\n", algoID, name, hex.EncodeToString([]byte(key)))
+	return nil
+}
+
+func readInput(args []string) ([]byte, error) {
+	switch len(args) {
+	case 0:
+		return io.ReadAll(os.Stdin)
+	case 1:
+		return os.ReadFile(args[0])
+	default:
+		return nil, errors.New(cryptoUsage)
+	}
+}
+
+func stripSpace(data []byte) []byte {
+	return bytes.Join(bytes.Fields(data), nil)
+}
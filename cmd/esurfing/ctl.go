@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/control"
+)
+
+const ctlUsage = `usage: esurfing [-control socket] <command> [user]
+
+commands:
+  status           show every client of the running daemon
+  check <user>     run a connectivity check now
+  reauth <user>    log out and authenticate again
+  logout <user>    log out and pause the client
+  pause <user>     stop checking and re-authenticating
+  resume <user>    undo pause or logout
+  replay <file>... replay recorded trace files offline and compare
+  crypto ...       encrypt or decrypt portal payloads, see esurfing crypto
+
+user is a username, or username@interface for a single line`
+
+// runCtl talks to a running daemon for the subcommand in args.
+func runCtl(socket string, args []string) error {
+	c := control.Dial(socket)
+
+	var statuses []esurfing.Status
+	var err error
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		statuses, err = c.Status()
+	case args[0] != "status" && len(args) == 2:
+		statuses, err = c.Do(args[1], esurfing.Command(args[0]))
+	default:
+		return errors.New(ctlUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	printStatus(statuses)
+	return nil
+}
+
+func printStatus(statuses []esurfing.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USER\tINTERFACE\tPHASE\tUSER IP\tAC IP\tALGO ID\tLAST HEARTBEAT\tNEXT HEARTBEAT\tTICKET EXPIRY\tLAST ERROR")
+	for _, s := range statuses {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Username, s.BindInterface, s.Phase, dash(s.UserIP), dash(s.AcIP), dash(s.AlgoID),
+			formatTime(s.LastHeartbeat), formatTime(s.NextHeartbeat), formatTime(s.TicketExpiry), dash(s.LastError))
+	}
+	_ = w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.DateTime)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/control"
+	"github.com/DreamwareN/Esurfing-go/metrics"
+)
+
+func main() {
+	var configFilePath = flag.String("c", "config.json", "config file path")
+	var stateDir = flag.String("state-dir", "", "directory for per-account session state files, empty = do not persist")
+	var traceDir = flag.String("trace-dir", "", "directory for protocol trace files of every account, empty = no trace")
+	var controlSocket = flag.String("control", control.DefaultSocketPath(), "control socket path, empty = disabled")
+	var metricsAddress = flag.String("metrics", "", "prometheus metrics listen address, e.g. :9110, empty = disabled")
+	var logLevel = flag.String("log-level", "info", "log level: debug, info, warn or error")
+	var logFormat = flag.String("log-format", "text", "log format: text or json")
+	var debug = flag.Bool("debug", false, "log passwords, tickets and client ids in clear text")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		var err error
+		switch flag.Arg(0) {
+		case "replay":
+			err = runReplay(flag.Args()[1:])
+		case "crypto":
+			err = runCrypto(flag.Args()[1:])
+		default:
+			err = runCtl(*controlSocket, flag.Args())
+		}
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "invalid log level:", *logLevel)
+		os.Exit(2)
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		_, _ = fmt.Fprintln(os.Stderr, "invalid log format:", *logFormat)
+		os.Exit(2)
+	}
+	slog.SetDefault(slog.New(esurfing.NewLogHandler(os.Stdout, esurfing.LogOptions{
+		Level:       level,
+		JSON:        *logFormat == "json",
+		ShowSecrets: *debug,
+	})))
+
+	slog.Info("esurfing client v25.11.4")
+	slog.Info("reading config")
+
+	configs, err := loadConfig(*configFilePath, *stateDir, *traceDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	slog.Info("config loaded", "accounts", len(configs), "path", *configFilePath)
+
+	var group esurfing.Group
+
+	for _, c := range configs {
+		if err = group.Add(c); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *controlSocket != "" {
+		server, err := control.Listen(*controlSocket, &group)
+		switch {
+		case err == nil:
+			defer func() {
+				_ = server.Close()
+			}()
+		case flagSet("control"):
+			fatal(err)
+		default:
+			//the default socket is a convenience, e.g. a non-root run can not create it
+			slog.Warn("control socket disabled, set -control to pick another path", "err", err)
+		}
+	}
+
+	if *metricsAddress != "" {
+		go func() {
+			fatal(metrics.ListenAndServe(*metricsAddress, &group))
+		}()
+	}
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+	for sig := range signalChannel {
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		slog.Info("reloading config")
+		configs, err = loadConfig(*configFilePath, *stateDir, *traceDir)
+		if err != nil {
+			slog.Error("reload config error, keep running clients", "err", err)
+			continue
+		}
+		if err = group.Reload(configs); err != nil {
+			slog.Error("reload config error", "err", err)
+		}
+		slog.Info("config reloaded", "accounts", len(configs), "path", *configFilePath)
+	}
+
+	slog.Info("stopping all clients")
+
+	group.Stop()
+	slog.Info("exit")
+}
+
+// flagSet reports whether the flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// stateFileName names the default state file after the whole account, the
+// same username may run on several interfaces and namespaces.
+func stateFileName(c *esurfing.Config) string {
+	name := c.Username
+	if c.BindInterface != "" {
+		name += "@" + c.BindInterface
+	}
+	if c.Netns != "" {
+		name += "@" + c.Netns
+	}
+	//netns may be a path
+	return strings.ReplaceAll(name, "/", "_") + ".json"
+}
+
+func loadConfig(path string, stateDir string, traceDir string) ([]*esurfing.Config, error) {
+	configs, err := esurfing.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range configs {
+		if c.StateFile == "" && stateDir != "" {
+			c.StateFile = filepath.Join(stateDir, stateFileName(c))
+		}
+		if c.TraceDir == "" {
+			c.TraceDir = traceDir
+		}
+	}
+	return configs, nil
+}
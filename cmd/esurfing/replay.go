@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DreamwareN/Esurfing-go/esurfingtest"
+)
+
+// runReplay replays recorded trace files against a fresh client and reports
+// every file whose requests or resulting session differ from the recording.
+func runReplay(paths []string) error {
+	if len(paths) == 0 {
+		return errors.New("usage: esurfing replay <trace.jsonl>...")
+	}
+
+	failed := 0
+	for _, path := range paths {
+		result, err := esurfingtest.ReplayFile(path)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			continue
+		}
+		if result.OK() {
+			fmt.Printf("ok   %s (%d exchanges)\n", path, result.Exchanges)
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %s: replayed %d of %d exchanges\n", path, result.Replayed, result.Exchanges)
+		for _, m := range result.Mismatches {
+			fmt.Printf("     mismatch: %s\n", m)
+		}
+		for _, err := range result.Errors {
+			fmt.Printf("     client error: %v\n", err)
+		}
+		if !result.SessionMatches() {
+			fmt.Printf("     session: got %+v\n", result.Got)
+			fmt.Printf("              want %+v\n", result.Want)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d traces failed", failed, len(paths))
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package esurfing
 
 import (
 	"encoding/json"
@@ -7,27 +7,79 @@ import (
 )
 
 type Config struct {
-	Username      string `json:"username"`
-	Password      string `json:"password"`
-	CheckInterval int    `json:"check_interval"`
-	RetryInterval int    `json:"retry_interval"`
-	BindInterface string `json:"bind_interface"`
-	DnsAddress    string `json:"dns_address"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	CheckInterval    int    `json:"check_interval"`
+	RetryInterval    int    `json:"retry_interval"`
+	RetryMaxInterval int    `json:"retry_max_interval"`
+	RetryMaxAttempts int    `json:"retry_max_attempts"`
+	BindInterface    string `json:"bind_interface"`
+	DnsAddress       string `json:"dns_address"`
+	StateFile        string `json:"state_file"`
+	TraceDir         string `json:"trace_dir"`
+	// Identity is how the device identity reported to the portal is chosen:
+	// "random" (default) makes up a new one on every auth, "username"
+	// derives a stable one from the username. Hostname, MacAddress and
+	// ClientID override single parts of it.
+	Identity string `json:"identity"`
+	Hostname string `json:"hostname"`
+	// MacAddress is a fixed MAC, or "interface" for the real MAC of BindInterface.
+	MacAddress string `json:"mac_address"`
+	ClientID   string `json:"client_id"`
+	// Profile names the client fingerprint to present, see
+	// protocol.ProfileNames, default android. UserAgent, Accept and Ostag
+	// override single fields of it, e.g. from a capture of another client.
+	Profile   string `json:"profile"`
+	UserAgent string `json:"user_agent"`
+	Accept    string `json:"accept"`
+	Ostag     string `json:"ostag"`
+	// IPv6 is the address reported to the portal: empty reports none,
+	// "auto" detects the global address of BindInterface (or of the default
+	// route), anything else is used as is.
+	IPv6 string `json:"ipv6"`
+	// IPv6Probe is a URL answering 204 that is checked over IPv6 after every
+	// successful connectivity check, empty = no IPv6 check.
+	IPv6Probe string `json:"ipv6_probe"`
+	// Probes are the URLs checked to tell whether the network is up, default
+	// DefaultProbeURL. ProbeQuorum of them must succeed, default a majority.
+	Probes      []Probe `json:"probes"`
+	ProbeQuorum int     `json:"probe_quorum"`
+	// Netns is the Linux network namespace all sockets of the account are
+	// created in, a name from ip netns or a path, empty = the daemon's own.
+	Netns string `json:"netns"`
+	// Fwmark is the SO_MARK set on every socket, for policy routing on
+	// multi-WAN routers, 0 = none. BindToDevice additionally binds every
+	// socket to BindInterface with SO_BINDTODEVICE. Both are Linux only.
+	Fwmark       int  `json:"fwmark"`
+	BindToDevice bool `json:"bind_to_device"`
+	// PortalKeys uses key material the portal sends with the algo ID instead
+	// of the built-in keys. Its layout is a guess, so it is off by default.
+	PortalKeys bool `json:"portal_keys"`
 }
 
-var Configs []*Config
+// Probe is one connectivity check URL.
+type Probe struct {
+	URL string `json:"url"`
+	// Status is the status code of a working network, default 204.
+	Status int `json:"status"`
+	// Body, when set, must appear in the response body, for probes that
+	// answer 200 with a fixed page.
+	Body string `json:"body"`
+}
 
-func LoadConfig(configPath string) error {
+func LoadConfig(configPath string) ([]*Config, error) {
 	file, err := os.ReadFile(configPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return errors.New("config file does not exist: " + configPath)
+			return nil, errors.New("config file does not exist: " + configPath)
 		}
-		return err
+		return nil, err
 	}
-	err = json.Unmarshal(file, &Configs)
+
+	var configs []*Config
+	err = json.Unmarshal(file, &configs)
 	if err != nil {
-		return errors.New("load config file error: " + err.Error())
+		return nil, errors.New("load config file error: " + err.Error())
 	}
-	return nil
+	return configs, nil
 }
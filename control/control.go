@@ -0,0 +1,180 @@
+// Package control exposes a running Group over a local Unix socket, and
+// provides the client used by the CLI subcommands to talk to it.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+)
+
+// DefaultSocketPath is under /run, writable by root only, so no other user
+// can put a socket or symlink there first. Other systems have no such
+// directory and leave the socket opt-in.
+func DefaultSocketPath() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	return "/run/esurfing.sock"
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Server struct {
+	group    *esurfing.Group
+	listener net.Listener
+	server   *http.Server
+}
+
+// Listen serves the control API for group on the Unix socket at path. A stale
+// socket left behind by a crashed daemon is removed, a live one is an error.
+func Listen(path string, group *esurfing.Group) (*Server, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another daemon", path)
+	}
+	_ = os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	s := &Server{group: group, listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /clients/{user}/{command}", s.handleCommand)
+	s.server = &http.Server{Handler: mux}
+
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	clients := s.group.Clients()
+	statuses := make([]esurfing.Status, 0, len(clients))
+	for _, c := range clients {
+		statuses = append(statuses, c.Status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("user")
+	command := esurfing.Command(r.PathValue("command"))
+
+	var statuses []esurfing.Status
+	for _, c := range s.group.Clients() {
+		if !matchUser(c, user) {
+			continue
+		}
+
+		err := c.Do(command)
+		if errors.Is(err, esurfing.ErrUnknownCommand) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error() + ": " + string(command)})
+			return
+		}
+		if err != nil && !errors.Is(err, esurfing.ErrClientStopped) {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		statuses = append(statuses, c.Status())
+	}
+
+	if len(statuses) == 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no client for user " + user})
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// matchUser accepts either a bare username, acting on every line of that
+// account, or username@interface for a single one.
+func matchUser(c *esurfing.Client, user string) bool {
+	status := c.Status()
+	return user == status.Username || user == status.Username+"@"+status.BindInterface
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Client talks to a daemon's control socket.
+type Client struct {
+	httpClient *http.Client
+}
+
+func Dial(path string) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+func (c *Client) Status() ([]esurfing.Status, error) {
+	return c.do(http.MethodGet, "/status")
+}
+
+// Do runs command on the clients of user and returns their status afterwards.
+func (c *Client) Do(user string, command esurfing.Command) ([]esurfing.Status, error) {
+	return c.do(http.MethodPost, "/clients/"+url.PathEscape(user)+"/"+url.PathEscape(string(command)))
+}
+
+func (c *Client) do(method, path string) ([]esurfing.Status, error) {
+	req, err := http.NewRequest(method, "http://esurfing"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err = json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		return nil, errors.New(e.Error)
+	}
+
+	var statuses []esurfing.Status
+	err = json.NewDecoder(resp.Body).Decode(&statuses)
+	return statuses, err
+}
@@ -0,0 +1,97 @@
+package esurfing
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrBadCredentials   = errors.New("bad credentials")
+	ErrAccountSuspended = errors.New("account suspended")
+	ErrTooManyDevices   = errors.New("too many devices online")
+	ErrTicketExpired    = errors.New("ticket expired")
+	ErrUnknownAlgo      = errors.New("unknown algo id")
+	// ErrProbeUnreachable means no probe host answered at all, which says
+	// nothing about whether a login is needed.
+	ErrProbeUnreachable = errors.New("probe hosts unreachable")
+)
+
+// AuthError wraps a failure inside the authorization flow, as opposed to a
+// failure of the connectivity probe itself. Only these are retried with backoff.
+type AuthError struct {
+	// Stage is the step of Auth that failed, e.g. "GetTicket" or "Login".
+	Stage string
+	Err   error
+}
+
+func (e *AuthError) Error() string {
+	return "auth failed at " + e.Stage + ": " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// portalErrorKeywords maps fragments of the portal's error message to the
+// error they indicate. The portal does not document its codes, so the message
+// text is the only reliable signal across schools.
+var portalErrorKeywords = []struct {
+	keywords []string
+	err      error
+}{
+	{[]string{"密码", "用户名", "账号不存在", "password", "credential"}, ErrBadCredentials},
+	{[]string{"欠费", "停机", "暂停", "冻结", "suspend", "overdue", "arrear"}, ErrAccountSuspended},
+	{[]string{"终端数", "设备数", "在线数", "多终端", "too many"}, ErrTooManyDevices},
+	{[]string{"票据", "ticket"}, ErrTicketExpired},
+}
+
+// PortalError is a failure reported by the portal itself in a response body.
+type PortalError struct {
+	Code    string
+	Message string
+	// Err is the classified cause, nil when the message is not recognized.
+	Err error
+}
+
+func NewPortalError(code, message string) *PortalError {
+	e := &PortalError{Code: code, Message: message}
+	lower := strings.ToLower(message)
+	for _, k := range portalErrorKeywords {
+		for _, keyword := range k.keywords {
+			if strings.Contains(lower, keyword) {
+				e.Err = k.err
+				return e
+			}
+		}
+	}
+	return e
+}
+
+func (e *PortalError) Error() string {
+	msg := "portal error"
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return msg + " (code:" + e.Code + " message:" + e.Message + ")"
+}
+
+func (e *PortalError) Unwrap() error {
+	return e.Err
+}
+
+// portalResult turns the code/message pair carried by a response into an
+// error, or nil when the response reports success.
+func portalResult(code, message string) error {
+	if code == "" || code == "0" {
+		return nil
+	}
+	return NewPortalError(code, message)
+}
+
+// IsPermanent reports whether retrying err cannot succeed without operator
+// intervention, such as fixing the password or paying the bill.
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrBadCredentials) ||
+		errors.Is(err, ErrAccountSuspended) ||
+		errors.Is(err, ErrUnknownAlgo)
+}
@@ -0,0 +1,73 @@
+package esurfing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewPortalError(t *testing.T) {
+	tests := []struct {
+		message   string
+		want      error
+		permanent bool
+	}{
+		{"用户名或密码错误", ErrBadCredentials, true},
+		{"账号不存在", ErrBadCredentials, true},
+		{"Invalid Password", ErrBadCredentials, true},
+		{"您的账号已欠费停机", ErrAccountSuspended, true},
+		{"账号已冻结", ErrAccountSuspended, true},
+		{"account SUSPENDED", ErrAccountSuspended, true},
+		{"在线终端数已达上限", ErrTooManyDevices, false},
+		{"Too many devices online", ErrTooManyDevices, false},
+		{"票据已失效", ErrTicketExpired, false},
+		{"ticket expired", ErrTicketExpired, false},
+		{"系统繁忙，请稍后再试", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			err := NewPortalError("1", tt.message)
+			if err.Err != tt.want {
+				t.Fatalf("classified as %v, want %v", err.Err, tt.want)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("errors.Is(%v, %v) is false", err, tt.want)
+			}
+			//the stage wrapper must not hide the cause
+			wrapped := &AuthError{Stage: "Login", Err: err}
+			if IsPermanent(wrapped) != tt.permanent {
+				t.Fatalf("IsPermanent(%v) = %v, want %v", wrapped, !tt.permanent, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: 1234", ErrUnknownAlgo), true},
+		{ErrProbeUnreachable, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsPermanent(tt.err); got != tt.want {
+			t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPortalResult(t *testing.T) {
+	for _, code := range []string{"", "0"} {
+		if err := portalResult(code, "ok"); err != nil {
+			t.Errorf("code %q: %v", code, err)
+		}
+	}
+	var portalErr *PortalError
+	if err := portalResult("13", "终端数超限"); !errors.As(err, &portalErr) || portalErr.Code != "13" {
+		t.Errorf("code 13: %v", err)
+	}
+}
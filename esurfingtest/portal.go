@@ -0,0 +1,386 @@
+// Package esurfingtest provides an in-process fake of the eSurfing captive
+// portal for running the client offline.
+package esurfingtest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+)
+
+const (
+	portalBase   = "http://portal.mock"
+	algoIDPrefix = "\x00\x00\x00"
+)
+
+// Portal is an in-process fake of the eSurfing captive portal. It
+// implements both http.Handler and http.RoundTripper, so a Client can be
+// pointed at it by replacing HttpClient.Transport; every request is served
+// locally no matter which host it was addressed to.
+type Portal struct {
+	Username string
+	Password string
+	Domain   string
+	Area     string
+	SchoolID string
+	UserIP   string
+	AcIP     string
+
+	// AlgoIDs is the list of algorithms handed out by the ticket URL, one per
+	// session in rotation. It defaults to every algorithm known to the cipher package.
+	AlgoIDs []string
+	// RotateKeys makes every negotiation send fresh random key material with
+	// the algo ID instead of relying on the built-in keys. A Client only
+	// follows it with Config.PortalKeys set.
+	RotateKeys bool
+	// ExtraKey, when RotateKeys is off, is sent with the algo ID but not
+	// used, like key material in a layout the client does not understand.
+	ExtraKey []byte
+	// KeepRetry is the heartbeat interval returned by login, in seconds.
+	KeepRetry int
+	// Interval is the heartbeat interval returned by each heartbeat, in seconds.
+	Interval int
+	// TicketLifetime is the expiry sent with every ticket, in seconds.
+	// Heartbeats with an older ticket are rejected as expired.
+	TicketLifetime int
+	// Level is the account level returned by each heartbeat.
+	Level int
+	// AgainstInterval and DomainConfig are returned by login, if set.
+	AgainstInterval int
+	DomainConfig    string
+	// RejectCode and RejectMessage, when set, make every login fail with that
+	// error, e.g. to simulate an overdue account.
+	RejectCode    string
+	RejectMessage string
+
+	mu       sync.Mutex
+	next     int
+	online   bool
+	algoID   string
+	key      []byte
+	ticket   string
+	expiry   time.Time
+	clientID string
+	stats    Stats
+}
+
+// Stats counts the requests a Portal has served.
+type Stats struct {
+	Probes     int
+	Redirects  int
+	Indexes    int
+	AlgoIDs    int
+	Tickets    int
+	Logins     int
+	Heartbeats int
+	Logouts    int
+	Failures   int
+}
+
+func NewPortal(username, password string) *Portal {
+	return &Portal{
+		Username:       username,
+		Password:       password,
+		Domain:         "mock.campus",
+		Area:           "mock",
+		SchoolID:       "1000",
+		UserIP:         "10.0.0.2",
+		AcIP:           "10.0.0.1",
+		AlgoIDs:        cipher.AlgoIDs(),
+		KeepRetry:      10,
+		Interval:       10,
+		TicketLifetime: 86400,
+	}
+}
+
+// Online reports whether the portal currently considers the client logged in.
+func (p *Portal) Online() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.online
+}
+
+// AlgoID returns the algorithm negotiated for the current session.
+func (p *Portal) AlgoID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.algoID
+}
+
+// Kick drops the current session, as the portal does when a ticket expires,
+// so the next probe is redirected again.
+func (p *Portal) Kick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.online = false
+}
+
+func (p *Portal) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *Portal) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func (p *Portal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/generate_204":
+		p.serveProbe(w)
+	case "/redirect":
+		p.serveRedirect(w)
+	case "/index":
+		p.serveIndex(w)
+	case "/ticket":
+		p.serveTicket(w, r)
+	case "/auth":
+		p.serveAuth(w, r)
+	case "/keep":
+		p.serveKeep(w, r)
+	case "/term":
+		p.serveTerm(w, r)
+	default:
+		p.fail(w, http.StatusNotFound, "unknown path: "+r.URL.Path)
+	}
+}
+
+func (p *Portal) serveProbe(w http.ResponseWriter) {
+	p.stats.Probes++
+	if p.online {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Location", portalBase+"/redirect")
+	w.WriteHeader(http.StatusFound)
+}
+
+func (p *Portal) serveRedirect(w http.ResponseWriter) {
+	p.stats.Redirects++
+	w.Header().Set("domain", p.Domain)
+	w.Header().Set("area", p.Area)
+	w.Header().Set("schoolid", p.SchoolID)
+	w.Header().Set("Location", portalBase+"/index")
+	w.WriteHeader(http.StatusFound)
+}
+
+func (p *Portal) serveIndex(w http.ResponseWriter) {
+	p.stats.Indexes++
+	ticketURL := fmt.Sprintf("%s/ticket?wlanuserip=%s&wlanacip=%s", portalBase, p.UserIP, p.AcIP)
+	_, _ = fmt.Fprintf(w, "<html><head>%s<config><ticket-url><![CDATA[%s&width=0&adtype=0]]></ticket-url>"+
+		"<auth-url><![CDATA[%s/auth]]></auth-url></config>%s</head><body></body></html>",
+		protocol.ConfigStartTag, ticketURL, portalBase, protocol.ConfigEndTag)
+}
+
+func (p *Portal) serveTicket(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	//algo negotiation posts the client's current algo id in plain text
+	if string(body) == r.Header.Get("Algo-ID") {
+		p.serveAlgoID(w, r)
+		return
+	}
+
+	var req protocol.TicketRequest
+	if !p.decodeXML(w, r, body, &req) {
+		return
+	}
+	if req.ClientID != p.clientID || req.Ipv4 != p.UserIP || req.Gwip != p.AcIP {
+		p.fail(w, http.StatusBadRequest, "ticket request does not match session")
+		return
+	}
+
+	p.stats.Tickets++
+	p.ticket = esurfing.GenerateRandomString(32)
+	p.expiry = time.Now().Add(time.Duration(p.TicketLifetime) * time.Second)
+	p.writeXML(w, &protocol.TicketResponse{Ticket: p.ticket, Expire: strconv.Itoa(p.TicketLifetime)})
+}
+
+func (p *Portal) serveAlgoID(w http.ResponseWriter, r *http.Request) {
+	if len(p.AlgoIDs) == 0 {
+		p.fail(w, http.StatusInternalServerError, "no algorithm configured")
+		return
+	}
+
+	p.stats.AlgoIDs++
+	p.algoID = p.AlgoIDs[p.next%len(p.AlgoIDs)]
+	p.next++
+	p.online = false
+	p.ticket = ""
+	p.clientID = r.Header.Get("Client-ID")
+	p.key = nil
+	if p.RotateKeys {
+		p.key = make([]byte, cipher.KeySize(p.algoID))
+		_, _ = rand.Read(p.key)
+	}
+
+	var frame bytes.Buffer
+	frame.WriteString(algoIDPrefix)
+	key := p.key
+	if key == nil {
+		key = p.ExtraKey
+	}
+	frame.WriteByte(byte(len(key)))
+	frame.Write(key)
+	frame.WriteByte(byte(len(p.algoID)))
+	frame.WriteString(p.algoID)
+	_, _ = w.Write(frame.Bytes())
+}
+
+func (p *Portal) serveAuth(w http.ResponseWriter, r *http.Request) {
+	var req protocol.LoginRequest
+	if !p.readXML(w, r, &req) {
+		return
+	}
+	if p.ticket == "" || req.Ticket != p.ticket {
+		p.fail(w, http.StatusForbidden, "invalid ticket")
+		return
+	}
+	if req.Userid != p.Username || req.Passwd != p.Password {
+		p.stats.Failures++
+		p.writeXML(w, &protocol.LoginResponse{Code: "1", Message: "用户名或密码错误"})
+		return
+	}
+	if p.RejectCode != "" {
+		p.stats.Failures++
+		p.writeXML(w, &protocol.LoginResponse{Code: p.RejectCode, Message: p.RejectMessage})
+		return
+	}
+
+	p.stats.Logins++
+	p.online = true
+	resp := &protocol.LoginResponse{
+		Userid:       req.Userid,
+		KeepRetry:    strconv.Itoa(p.KeepRetry),
+		KeepURL:      portalBase + "/keep",
+		TermURL:      portalBase + "/term",
+		DomainConfig: p.DomainConfig,
+	}
+	if p.AgainstInterval > 0 {
+		resp.UserConfig.AgainstInterval = strconv.Itoa(p.AgainstInterval)
+	}
+	p.writeXML(w, resp)
+}
+
+func (p *Portal) serveKeep(w http.ResponseWriter, r *http.Request) {
+	var req protocol.State
+	if !p.readXML(w, r, &req) {
+		return
+	}
+	if !p.online || req.Ticket != p.ticket || time.Now().After(p.expiry) {
+		p.stats.Failures++
+		p.writeXML(w, &protocol.StateResponse{Code: "2", Message: "ticket expired"})
+		return
+	}
+
+	p.stats.Heartbeats++
+	p.writeXML(w, &protocol.StateResponse{Interval: strconv.Itoa(p.Interval), Level: strconv.Itoa(p.Level)})
+}
+
+func (p *Portal) serveTerm(w http.ResponseWriter, r *http.Request) {
+	var req protocol.State
+	if !p.readXML(w, r, &req) {
+		return
+	}
+	if req.Ticket != p.ticket {
+		p.fail(w, http.StatusForbidden, "invalid ticket")
+		return
+	}
+
+	p.stats.Logouts++
+	p.online = false
+	p.ticket = ""
+	p.writeXML(w, &protocol.StateResponse{})
+}
+
+// readXML verifies the checksum header, decrypts the body with the session
+// algorithm and unmarshals it into v. It writes an error response and returns
+// false when any step fails.
+func (p *Portal) readXML(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.fail(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return p.decodeXML(w, r, body, v)
+}
+
+func (p *Portal) decodeXML(w http.ResponseWriter, r *http.Request, body []byte, v any) bool {
+	sum := md5.Sum(body)
+	if r.Header.Get("CDC-Checksum") != hex.EncodeToString(sum[:]) {
+		p.fail(w, http.StatusBadRequest, "checksum mismatch")
+		return false
+	}
+	if r.Header.Get("Algo-ID") != p.algoID {
+		p.fail(w, http.StatusBadRequest, "algo id mismatch")
+		return false
+	}
+
+	c, err := cipher.NewCipherWithKey(p.algoID, p.key)
+	if err != nil {
+		p.fail(w, http.StatusBadRequest, "algo id "+p.algoID+": "+err.Error())
+		return false
+	}
+	plain, err := c.Decrypt(body)
+	if err != nil {
+		p.fail(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err = xml.Unmarshal(plain, v); err != nil {
+		p.fail(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func (p *Portal) writeXML(w http.ResponseWriter, v any) {
+	out, err := xml.Marshal(v)
+	if err != nil {
+		p.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c, err := cipher.NewCipherWithKey(p.algoID, p.key)
+	if err != nil {
+		p.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	enc, err := c.Encrypt(append([]byte(protocol.XMLHeader), out...))
+	if err != nil {
+		p.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, _ = w.Write(enc)
+}
+
+func (p *Portal) fail(w http.ResponseWriter, status int, msg string) {
+	p.stats.Failures++
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,427 @@
+package esurfingtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+	"github.com/DreamwareN/Esurfing-go/trace"
+)
+
+// volatileElements are request XML elements that legitimately differ between
+// a recording and its replay: clocks and the random per-auth device identity.
+var volatileElements = map[string]bool{
+	"request/local-time": true,
+	"request/client-id":  true,
+	"request/host-name":  true,
+	"request/mac":        true,
+	"request/ostag":      true,
+	"request/passwd":     true,
+}
+
+// ReplayTransport answers requests from a recorded trace, in order, and
+// records every request that differs from the one recorded at that position.
+type ReplayTransport struct {
+	mu         sync.Mutex
+	exchanges  []trace.Exchange
+	next       int
+	mismatches []string
+	//key material of every algo negotiated so far
+	keys map[string][]byte
+}
+
+func NewReplayTransport(exchanges []trace.Exchange) *ReplayTransport {
+	return &ReplayTransport{exchanges: exchanges, keys: map[string][]byte{}}
+}
+
+// Peek returns the next recorded exchange, or nil when all were replayed.
+func (t *ReplayTransport) Peek() *trace.Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next >= len(t.exchanges) {
+		return nil
+	}
+	return &t.exchanges[t.next]
+}
+
+func (t *ReplayTransport) Replayed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
+}
+
+func (t *ReplayTransport) Mismatches() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.mismatches...)
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.next >= len(t.exchanges) {
+		return nil, t.mismatch("unexpected %s %s after the end of the trace", req.Method, req.URL)
+	}
+	t.pickProbe(req)
+	e := &t.exchanges[t.next]
+	t.next++
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.compare(e, req, body); err != nil {
+		return nil, err
+	}
+
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+
+	respBody := []byte(e.ResponseBody)
+	if e.ResponseXML == "" {
+		if algoID, key := portalKey(respBody); key != nil {
+			t.keys[algoID] = key
+		}
+	} else {
+		c, err := t.cipher(req.Header.Get("Algo-ID"))
+		if err != nil {
+			return nil, err
+		}
+		enc, err := c.Encrypt([]byte(e.ResponseXML))
+		if err != nil {
+			return nil, err
+		}
+		respBody = enc
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.ResponseHeader.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// pickProbe moves the probe recorded for req to the front when the next
+// exchanges are probes. The probes of one check run concurrently, so they
+// neither were recorded nor are replayed in a fixed order.
+func (t *ReplayTransport) pickProbe(req *http.Request) {
+	for i := t.next; i < len(t.exchanges) && t.exchanges[i].Probe != nil; i++ {
+		if t.exchanges[i].Method == req.Method && t.exchanges[i].URL == req.URL.String() {
+			t.exchanges[t.next], t.exchanges[i] = t.exchanges[i], t.exchanges[t.next]
+			return
+		}
+	}
+}
+
+func (t *ReplayTransport) compare(e *trace.Exchange, req *http.Request, body []byte) error {
+	if req.Method != e.Method || req.URL.String() != e.URL {
+		return t.mismatch("exchange %d: got %s %s, recorded %s %s", e.Seq, req.Method, req.URL, e.Method, e.URL)
+	}
+	if got, want := req.Header.Get("Algo-ID"), e.RequestHeader.Get("Algo-ID"); got != want {
+		return t.mismatch("exchange %d: got Algo-ID %q, recorded %q", e.Seq, got, want)
+	}
+
+	if e.RequestXML == "" {
+		if string(body) != e.RequestBody {
+			return t.mismatch("exchange %d: got body %q, recorded %q", e.Seq, body, e.RequestBody)
+		}
+		return nil
+	}
+
+	c, err := t.cipher(req.Header.Get("Algo-ID"))
+	if err != nil {
+		return t.mismatch("exchange %d: Algo-ID %q: %v", e.Seq, req.Header.Get("Algo-ID"), err)
+	}
+	plain, err := c.Decrypt(body)
+	if err != nil {
+		return t.mismatch("exchange %d: can not decrypt request: %v", e.Seq, err)
+	}
+	got, err := flattenXML(plain)
+	if err != nil {
+		return t.mismatch("exchange %d: invalid request XML: %v", e.Seq, err)
+	}
+	want, err := flattenXML([]byte(e.RequestXML))
+	if err != nil {
+		return t.mismatch("exchange %d: invalid recorded XML: %v", e.Seq, err)
+	}
+	for path := range mergeKeys(got, want) {
+		if !volatileElements[path] && got[path] != want[path] {
+			return t.mismatch("exchange %d: %s is %q, recorded %q", e.Seq, path, got[path], want[path])
+		}
+	}
+	return nil
+}
+
+func (t *ReplayTransport) cipher(algoID string) (cipher.Cipher, error) {
+	return cipher.NewCipherWithKey(algoID, t.keys[algoID])
+}
+
+func (t *ReplayTransport) mismatch(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	t.mismatches = append(t.mismatches, msg)
+	return errors.New("replay mismatch: " + msg)
+}
+
+// flattenXML maps the slash separated path of every element to its text.
+func flattenXML(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	var path []string
+	var text strings.Builder
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			path = append(path, tok.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			values[strings.Join(path, "/")] = strings.TrimSpace(text.String())
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+}
+
+func mergeKeys(a, b map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// ReplayResult is the outcome of replaying one trace.
+type ReplayResult struct {
+	Exchanges  int
+	Replayed   int
+	Mismatches []string
+	// Errors are the failures the client itself reported during the replay.
+	Errors []error
+	Got    esurfing.Session
+	Want   esurfing.Session
+}
+
+func (r *ReplayResult) OK() bool {
+	return len(r.Mismatches) == 0 && r.Replayed == r.Exchanges && r.SessionMatches()
+}
+
+// SessionMatches reports whether the client ended up with the recorded
+// session, ignoring the fields that are randomly generated by every auth.
+func (r *ReplayResult) SessionMatches() bool {
+	return reflect.DeepEqual(sessionState(r.Got), sessionState(r.Want))
+}
+
+func sessionState(s esurfing.Session) esurfing.Session {
+	var key []byte
+	if len(s.AlgoKey) > 0 {
+		key = s.AlgoKey
+	}
+	return esurfing.Session{
+		AlgoKey:  key,
+		Ticket:   s.Ticket,
+		AlgoID:   s.AlgoID,
+		UserIP:   s.UserIP,
+		AcIP:     s.AcIP,
+		Domain:   s.Domain,
+		Area:     s.Area,
+		SchoolID: s.SchoolID,
+		KeepUrl:  s.KeepUrl,
+		TermUrl:  s.TermUrl,
+	}
+}
+
+// ReplayFile replays the trace at path, see Replay.
+func ReplayFile(path string) (*ReplayResult, error) {
+	exchanges, err := trace.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(exchanges)
+}
+
+// Replay drives a fresh client through the recorded exchanges: probes run
+// CheckNetwork, which authenticates when the recording was redirected,
+// and requests to the keep and term URLs send heartbeats and log out. The
+// client must make the same requests in the same order and end up with the
+// session the recording implies.
+func Replay(exchanges []trace.Exchange) (*ReplayResult, error) {
+	if len(exchanges) == 0 || exchanges[0].Method != http.MethodGet {
+		return nil, errors.New("trace must start with a connectivity probe")
+	}
+
+	username, ok := recordedValue(exchanges, "request/userid")
+	if !ok {
+		username = "replay"
+	}
+	//present the same fingerprint as the recorded client, overrides included
+	userAgent, _ := recordedValue(exchanges, "request/user-agent")
+	accept := exchanges[0].RequestHeader.Get("Accept")
+	ipv6, _ := recordedValue(exchanges, "request/ipv6")
+	probes, quorum := recordedProbes(exchanges)
+	c, err := esurfing.NewClient(&esurfing.Config{
+		Username:    username,
+		Password:    "***",
+		UserAgent:   userAgent,
+		Accept:      accept,
+		IPv6:        ipv6,
+		Probes:      probes,
+		ProbeQuorum: quorum,
+		//the replayed responses are encrypted with whatever key the recording carries
+		PortalKeys: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.Cancel()
+
+	replay := NewReplayTransport(exchanges)
+	c.HttpClient.Transport = replay
+	result := &ReplayResult{Exchanges: len(exchanges), Want: expectedSession(exchanges)}
+
+	for next := replay.Peek(); next != nil; next = replay.Peek() {
+		before := replay.Replayed()
+		session := c.Session()
+
+		switch {
+		case next.Method == http.MethodGet:
+			err = c.CheckNetwork()
+		case next.URL == session.KeepUrl:
+			err = c.SendHeartbeat()
+		case next.URL == session.TermUrl:
+			c.Terminate()
+			err = nil
+		default:
+			err = fmt.Errorf("exchange %d (%s %s) does not start a client step", next.Seq, next.Method, next.URL)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+		}
+
+		//the term request forgets the session, keep what it was for comparison
+		if next.URL == session.TermUrl && session.TermUrl != "" {
+			result.Got = session
+		} else {
+			result.Got = c.Session()
+		}
+
+		if replay.Replayed() == before {
+			break
+		}
+	}
+
+	result.Replayed = replay.Replayed()
+	result.Mismatches = replay.Mismatches()
+	return result, nil
+}
+
+// recordedProbes returns the probes the recorded client ran, none for traces
+// that predate probe recording and were made with the default probe.
+func recordedProbes(exchanges []trace.Exchange) ([]esurfing.Probe, int) {
+	var probes []esurfing.Probe
+	quorum := 0
+	seen := map[string]bool{}
+	for _, e := range exchanges {
+		if e.Probe == nil || seen[e.URL] {
+			continue
+		}
+		seen[e.URL] = true
+		probes = append(probes, esurfing.Probe{URL: e.URL, Status: e.Probe.Status, Body: e.Probe.Body})
+		quorum = e.Probe.Quorum
+	}
+	return probes, quorum
+}
+
+// portalKey returns the key material of an algo ID response the client
+// would use, nil when there is none or it does not fit the algorithm.
+func portalKey(body []byte) (string, []byte) {
+	algoID, key, err := protocol.DecodeAlgoID(body)
+	if err != nil || key == "" {
+		return "", nil
+	}
+	if _, err = cipher.NewCipherWithKey(algoID, []byte(key)); err != nil {
+		return "", nil
+	}
+	return algoID, []byte(key)
+}
+
+// expectedSession derives the session a client should hold after the
+// recorded exchanges, from what the portal sent.
+func expectedSession(exchanges []trace.Exchange) esurfing.Session {
+	var s esurfing.Session
+	for _, e := range exchanges {
+		if domain := e.ResponseHeader.Get("domain"); domain != "" {
+			s.Domain = domain
+			s.Area = e.ResponseHeader.Get("area")
+			s.SchoolID = e.ResponseHeader.Get("schoolid")
+		}
+		if algoID := e.RequestHeader.Get("Algo-ID"); algoID != "" && algoID != protocol.ZeroAlgoID {
+			s.AlgoID = algoID
+		}
+		if _, key := portalKey([]byte(e.ResponseBody)); key != nil {
+			s.AlgoKey = key
+		}
+		if u, err := url.Parse(e.URL); err == nil && u.Query().Get("wlanuserip") != "" {
+			s.UserIP = u.Query().Get("wlanuserip")
+			s.AcIP = u.Query().Get("wlanacip")
+		}
+
+		values, err := flattenXML([]byte(e.ResponseXML))
+		if err != nil {
+			continue
+		}
+		if ticket := values["response/ticket"]; ticket != "" {
+			s.Ticket = ticket
+		}
+		if keepURL := values["response/keep-url"]; keepURL != "" {
+			s.KeepUrl = keepURL
+			s.TermUrl = values["response/term-url"]
+		}
+	}
+	return s
+}
+
+func recordedValue(exchanges []trace.Exchange, path string) (string, bool) {
+	for _, e := range exchanges {
+		values, err := flattenXML([]byte(e.RequestXML))
+		if err != nil {
+			continue
+		}
+		if v, ok := values[path]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,39 @@
+package esurfingtest
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestReplay replays every recorded trace under testdata/replay, so a change
+// that alters what the client sends to the portal fails go test.
+func TestReplay(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/replay/*.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no traces in testdata/replay")
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			result, err := ReplayFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.OK() {
+				t.Errorf("replayed %d of %d exchanges", result.Replayed, result.Exchanges)
+				for _, m := range result.Mismatches {
+					t.Error(m)
+				}
+				for _, err := range result.Errors {
+					t.Error(err)
+				}
+				if !result.SessionMatches() {
+					t.Errorf("session %+v, recorded %+v", result.Got, result.Want)
+				}
+			}
+		})
+	}
+}
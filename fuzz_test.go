@@ -0,0 +1,42 @@
+package esurfing
+
+import (
+	"testing"
+	"time"
+)
+
+func FuzzParseInterval(f *testing.F) {
+	for _, seed := range []string{"600", " 60 ", "0", "-1", "86400", "86401", "9223372037", "abc", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		interval, err := parseInterval(value)
+		if err != nil {
+			return
+		}
+		//anything else panics in Ticker.Reset
+		if interval <= 0 || interval > maxHeartbeatInterval {
+			t.Fatalf("parseInterval(%q) = %v", value, interval)
+		}
+	})
+}
+
+func FuzzParseExpire(f *testing.F) {
+	now := time.Now()
+	for _, seed := range []string{"86400", "0", "-5", "9223372037", "2026-01-02 15:04:05", "tomorrow", "",
+		now.Add(time.Hour).Format(time.DateTime), now.AddDate(2, 0, 0).Format(time.DateTime)} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		expiry, err := parseExpire(value, now)
+		if err != nil || expiry.IsZero() {
+			return
+		}
+		//seconds and dates alike
+		if !expiry.After(now) || expiry.Sub(now) > maxTicketLifetime {
+			t.Fatalf("parseExpire(%q) = %v", value, expiry)
+		}
+	})
+}
@@ -5,4 +5,5 @@ go 1.25.3
 require (
 	github.com/emmansun/gmsm v0.34.1
 	github.com/google/uuid v1.6.0
+	golang.org/x/crypto v0.41.0
 )
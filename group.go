@@ -0,0 +1,226 @@
+package esurfing
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Group runs a set of clients and waits for all of them to stop. Each embedder
+// owns its own Group, so independent sets of accounts can share a process.
+type Group struct {
+	// Prepare, if set, is called on every client the group creates from a
+	// config before it is started, e.g. to replace its transport.
+	Prepare func(c *Client)
+
+	//changeMu serializes Go, Add and Reload and is held while replaced
+	//clients log out, mu only guards members so status reads never wait on that
+	changeMu sync.Mutex
+	mu       sync.Mutex
+	members  []*member
+	wg       sync.WaitGroup
+}
+
+type member struct {
+	// config is a copy taken before NewClient fills in defaults, so Reload
+	// compares what the user wrote rather than what the client derived.
+	config Config
+	client *Client
+	done   chan struct{}
+}
+
+func (m *member) key() string {
+	return configKey(&m.config)
+}
+
+func configKey(c *Config) string {
+	iface := c.BindInterface
+	if iface == "" {
+		iface = "sys_default"
+	}
+	//the same interface name can exist in several namespaces
+	if c.Netns != "" {
+		return c.Username + "@" + iface + "@" + c.Netns
+	}
+	return c.Username + "@" + iface
+}
+
+// duplicateKey returns the first account that appears twice in configs.
+func duplicateKey(configs []*Config) (string, bool) {
+	seen := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		key := configKey(config)
+		if seen[key] {
+			return key, true
+		}
+		seen[key] = true
+	}
+	return "", false
+}
+
+// Go starts the client in its own goroutine and tracks it until Start returns.
+func (g *Group) Go(c *Client) {
+	g.changeMu.Lock()
+	defer g.changeMu.Unlock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members = append(g.members, g.start(c))
+}
+
+// Add creates a client from config and starts it. An account that is
+// already in the group is an error.
+func (g *Group) Add(config *Config) error {
+	g.changeMu.Lock()
+	defer g.changeMu.Unlock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := configKey(config)
+	for _, m := range g.members {
+		if m.key() == key {
+			return errors.New("duplicate account " + key)
+		}
+	}
+	c, err := g.newClient(config)
+	if err != nil {
+		return err
+	}
+	g.members = append(g.members, g.start(c))
+	return nil
+}
+
+// newClient creates a client from config without starting it.
+func (g *Group) newClient(config *Config) (*Client, error) {
+	c, err := NewClient(config)
+	if err != nil {
+		return nil, errors.New("user " + config.Username + ": " + err.Error())
+	}
+	if g.Prepare != nil {
+		g.Prepare(c)
+	}
+	return c, nil
+}
+
+func (g *Group) start(c *Client) *member {
+	m := &member{config: c.rawConfig, client: c, done: make(chan struct{})}
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+		defer close(m.done)
+		c.Start()
+	}()
+	return m
+}
+
+func (g *Group) Clients() []*Client {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	clients := make([]*Client, 0, len(g.members))
+	for _, m := range g.members {
+		clients = append(clients, m.client)
+	}
+	return clients
+}
+
+// Reload brings the group in line with configs: accounts that are new are
+// started, accounts that disappeared are logged out, accounts whose config
+// changed are restarted and everything else keeps running untouched.
+// Accounts are matched by username, bound interface and netns; configs that
+// list an account twice are rejected as a whole.
+func (g *Group) Reload(configs []*Config) error {
+	if key, ok := duplicateKey(configs); ok {
+		return errors.New("duplicate account " + key)
+	}
+
+	g.changeMu.Lock()
+	defer g.changeMu.Unlock()
+
+	g.mu.Lock()
+	running := make(map[string]*member, len(g.members))
+	for _, m := range g.members {
+		running[m.key()] = m
+	}
+	g.mu.Unlock()
+
+	var errs []error
+	//next holds the members to keep and, where nil, the slot of a client in starts
+	var next []*member
+	var starts []*Client
+	var stops []*member
+	wanted := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		key := configKey(config)
+		wanted[key] = true
+
+		//clients that gave up are started again even when unchanged
+		old, ok := running[key]
+		if ok && reflect.DeepEqual(old.config, *config) && !old.stopped() {
+			next = append(next, old)
+			continue
+		}
+		//validated before the old client goes, a typo must not drop a healthy session
+		c, err := g.newClient(config)
+		if err != nil {
+			errs = append(errs, err)
+			if ok && !old.stopped() {
+				old.client.Log.Warn("invalid new config, keeping the running client", "err", err)
+				next = append(next, old)
+			}
+			continue
+		}
+		if ok {
+			old.client.Log.Info("config changed, restarting")
+			stops = append(stops, old)
+		}
+		next = append(next, nil)
+		starts = append(starts, c)
+	}
+
+	for key, m := range running {
+		if !wanted[key] {
+			m.client.Log.Info("removed from config, stopping")
+			stops = append(stops, m)
+		}
+	}
+
+	//all log out at once and without mu, a replacement starts only once the
+	//session it replaces is gone
+	for _, m := range stops {
+		m.client.Cancel()
+	}
+	for _, m := range stops {
+		<-m.done
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, m := range next {
+		if m == nil {
+			next[i] = g.start(starts[0])
+			starts = starts[1:]
+		}
+	}
+	g.members = next
+	return errors.Join(errs...)
+}
+
+func (m *member) stopped() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop cancels every client in the group and waits for them to log out.
+func (g *Group) Stop() {
+	g.mu.Lock()
+	for _, m := range g.members {
+		m.client.Cancel()
+	}
+	g.mu.Unlock()
+	g.wg.Wait()
+}
@@ -0,0 +1,162 @@
+package esurfing_test
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+	"github.com/DreamwareN/Esurfing-go/esurfingtest"
+)
+
+// heldLogout passes requests to a portal but holds every logout until
+// release is closed. held receives a value whenever a logout is held.
+type heldLogout struct {
+	portal  *esurfingtest.Portal
+	held    chan<- struct{}
+	release <-chan struct{}
+}
+
+func (h *heldLogout) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/term" {
+		select {
+		case h.held <- struct{}{}:
+		default:
+		}
+		<-h.release
+	}
+	return h.portal.RoundTrip(req)
+}
+
+// portalGroup returns a group whose clients each talk to the portal of their
+// username, logouts held until release is closed.
+func portalGroup(t *testing.T, held chan<- struct{}, release <-chan struct{}, usernames ...string) (*esurfing.Group, map[string]*esurfingtest.Portal) {
+	portals := map[string]*esurfingtest.Portal{}
+	for _, username := range usernames {
+		portals[username] = esurfingtest.NewPortal(username, "pass")
+	}
+	var mu sync.Mutex
+	g := &esurfing.Group{Prepare: func(c *esurfing.Client) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.HttpClient.Transport = &heldLogout{portal: portals[c.Config.Username], held: held, release: release}
+		c.Log = slog.New(slog.DiscardHandler)
+	}}
+	t.Cleanup(g.Stop)
+	return g, portals
+}
+
+func waitOnline(t *testing.T, portals map[string]*esurfingtest.Portal) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for username, portal := range portals {
+		for !portal.Online() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s did not log in", username)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func clientsByUser(g *esurfing.Group) map[string]*esurfing.Client {
+	clients := map[string]*esurfing.Client{}
+	for _, c := range g.Clients() {
+		clients[c.Config.Username] = c
+	}
+	return clients
+}
+
+func TestGroupReload(t *testing.T) {
+	held, release := make(chan struct{}), make(chan struct{})
+	//released before the group stops, also when the test fails early
+	releaseOnce := sync.OnceFunc(func() { close(release) })
+	g, portals := portalGroup(t, held, release, "kept", "changed", "removed")
+	t.Cleanup(releaseOnce)
+	config := func(username string, checkInterval int) *esurfing.Config {
+		return &esurfing.Config{Username: username, Password: "pass", CheckInterval: checkInterval}
+	}
+
+	if err := g.Reload([]*esurfing.Config{config("kept", 0), config("changed", 0), config("removed", 0)}); err != nil {
+		t.Fatal(err)
+	}
+	waitOnline(t, portals)
+	before := clientsByUser(g)
+
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- g.Reload([]*esurfing.Config{config("kept", 0), config("changed", 5000)})
+	}()
+
+	select {
+	case <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no client logged out")
+	}
+	//the old clients are stuck logging out, status must still answer
+	statusRead := make(chan struct{})
+	go func() {
+		g.Clients()
+		close(statusRead)
+	}()
+	select {
+	case <-statusRead:
+	case <-time.After(time.Second):
+		t.Fatal("Clients blocks while clients log out")
+	}
+	releaseOnce()
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+
+	after := clientsByUser(g)
+	if len(after) != 2 {
+		t.Fatalf("%d clients after reload, want 2", len(after))
+	}
+	if after["kept"] != before["kept"] {
+		t.Error("unchanged account was restarted")
+	}
+	if after["changed"] == before["changed"] || after["changed"].Config.CheckInterval != 5000 {
+		t.Error("changed account kept its old client")
+	}
+	if after["removed"] != nil {
+		t.Error("removed account is still running")
+	}
+	if logouts := portals["removed"].Stats().Logouts; logouts != 1 {
+		t.Errorf("removed account logged out %d times, want 1", logouts)
+	}
+	if logouts := portals["changed"].Stats().Logouts; logouts != 1 {
+		t.Errorf("changed account logged out %d times, want 1", logouts)
+	}
+	if logouts := portals["kept"].Stats().Logouts; logouts != 0 {
+		t.Errorf("unchanged account logged out %d times", logouts)
+	}
+}
+
+func TestGroupDuplicate(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	g, _ := portalGroup(t, nil, release, "user")
+
+	if err := g.Add(&esurfing.Config{Username: "user", Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	//an empty interface is the default route, the same account as sys_default
+	if err := g.Add(&esurfing.Config{Username: "user", Password: "pass", BindInterface: "sys_default"}); err == nil {
+		t.Fatal("Add accepted an account that is already running")
+	}
+
+	running := g.Clients()[0]
+	err := g.Reload([]*esurfing.Config{
+		{Username: "user", Password: "pass"},
+		{Username: "user", Password: "other"},
+	})
+	if err == nil {
+		t.Fatal("Reload accepted the same account twice")
+	}
+	if clients := g.Clients(); len(clients) != 1 || clients[0] != running {
+		t.Fatal("a rejected Reload changed the group")
+	}
+}
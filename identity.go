@@ -0,0 +1,104 @@
+package esurfing
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/DreamwareN/Esurfing-go/transport"
+	"github.com/google/uuid"
+)
+
+const (
+	IdentityRandom   = "random"
+	IdentityUsername = "username"
+
+	// MacFromInterface selects the real MAC of the bound interface.
+	MacFromInterface = "interface"
+)
+
+// identityNamespace keeps client ids derived from usernames apart from any
+// other name based UUIDs.
+var identityNamespace = uuid.NewSHA1(uuid.NameSpaceOID, []byte("esurfing-go identity"))
+
+// validateIdentity checks the identity settings of config without touching
+// the network interface, which may not be up yet.
+func validateIdentity(config *Config) error {
+	switch config.Identity {
+	case "", IdentityRandom, IdentityUsername:
+	default:
+		return errors.New("unknown identity: " + config.Identity)
+	}
+	if config.MacAddress != "" && config.MacAddress != MacFromInterface {
+		if mac, err := net.ParseMAC(config.MacAddress); err != nil || len(mac) != 6 {
+			return errors.New("invalid mac_address: " + config.MacAddress)
+		}
+	}
+	if config.MacAddress == MacFromInterface && (config.BindInterface == "" || config.BindInterface == "sys_default") {
+		return errors.New("mac_address interface needs bind_interface")
+	}
+	if config.ClientID != "" {
+		if _, err := uuid.Parse(config.ClientID); err != nil {
+			return errors.New("invalid client_id: " + config.ClientID)
+		}
+	}
+	return nil
+}
+
+// GetIdentity picks the client id, hostname and MAC reported to the portal
+// for the next session.
+func (c *Client) GetIdentity() error {
+	if c.Config.Identity == IdentityUsername {
+		c.ClientID = uuid.NewSHA1(identityNamespace, []byte(c.Config.Username))
+		c.Hostname = usernameHostname(c.Config.Username)
+		c.MacAddress = usernameMAC(c.Config.Username)
+	} else {
+		c.ClientID = uuid.New()
+		c.Hostname = GenerateRandomString(10)
+		c.MacAddress = GenerateRandomMAC()
+	}
+
+	if c.Config.ClientID != "" {
+		c.ClientID = uuid.MustParse(c.Config.ClientID)
+	}
+	if c.Config.Hostname != "" {
+		c.Hostname = c.Config.Hostname
+	}
+
+	switch c.Config.MacAddress {
+	case "":
+	case MacFromInterface:
+		var mac string
+		err := transport.InNetns(c.Config.Netns, func() (err error) {
+			mac, err = transport.GetInterfaceMAC(c.Config.BindInterface)
+			return err
+		})
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		c.MacAddress = mac
+	default:
+		mac, _ := net.ParseMAC(c.Config.MacAddress)
+		c.MacAddress = mac.String()
+	}
+	return nil
+}
+
+// usernameHostname derives a hostname in the style of GenerateRandomString.
+func usernameHostname(username string) string {
+	sum := sha256.Sum256([]byte("hostname:" + username))
+	var b strings.Builder
+	for _, v := range sum[:10] {
+		b.WriteByte(charset[int(v)%len(charset)])
+	}
+	return b.String()
+}
+
+// usernameMAC derives a locally administered unicast MAC like GenerateRandomMAC.
+func usernameMAC(username string) string {
+	sum := sha256.Sum256([]byte("mac:" + username))
+	mac := sum[:6]
+	mac[0] = (mac[0] & 0xfe) | 0x02
+	return net.HardwareAddr(mac).String()
+}
@@ -0,0 +1,55 @@
+package esurfing
+
+import (
+	"time"
+
+	"github.com/DreamwareN/Esurfing-go/transport"
+)
+
+// interfaceSettle is how long the client waits after an interface event for
+// the rest of the burst before it checks the network.
+const interfaceSettle = time.Second
+
+// bindInterface returns the interface the client is bound to, empty when it
+// uses the system default route.
+func (c *Client) bindInterface() string {
+	if c.Config.BindInterface == "sys_default" {
+		return ""
+	}
+	return c.Config.BindInterface
+}
+
+// interfaceReady reports whether the bound interface has an IPv4 address to
+// dial from. The client waits while it has none rather than treating the
+// failed probes as an outage. The transport looks the address up on every
+// dial, so a changed address only needs to be logged here.
+func (c *Client) interfaceReady() bool {
+	name := c.bindInterface()
+	if name == "" {
+		return true
+	}
+
+	var ip string
+	err := transport.InNetns(c.Config.Netns, func() (err error) {
+		ip, err = transport.GetInterfaceIP(name)
+		return err
+	})
+	if err != nil {
+		if c.bindIP != "" || !c.bindChecked {
+			c.Log.Warn("waiting for interface", "err", err)
+		}
+		c.bindIP, c.bindChecked = "", true
+		c.setError(err)
+		c.setPhase(PhaseWaitingInterface)
+		return false
+	}
+
+	switch {
+	case c.bindChecked && c.bindIP == "":
+		c.Log.Info("interface is up", "ip", ip)
+	case c.bindIP != "" && c.bindIP != ip:
+		c.Log.Info("interface address changed", "old", c.bindIP, "new", ip)
+	}
+	c.bindIP, c.bindChecked = ip, true
+	return true
+}
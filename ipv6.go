@@ -0,0 +1,68 @@
+package esurfing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/DreamwareN/Esurfing-go/transport"
+)
+
+// IPv6Auto in Config.IPv6 detects the address to report.
+const IPv6Auto = "auto"
+
+// detectIPv6 returns the IPv6 address to report to the portal. Campuses
+// without IPv6 are common, so a failed detection is logged, not an error.
+func (c *Client) detectIPv6() string {
+	if c.Config.IPv6 != IPv6Auto {
+		return c.Config.IPv6
+	}
+
+	var ip string
+	err := transport.InNetns(c.Config.Netns, func() (err error) {
+		if name := c.bindInterface(); name != "" {
+			ip, err = transport.GetInterfaceIPv6(name)
+		} else {
+			ip, err = transport.DefaultIPv6()
+		}
+		return err
+	})
+	if err != nil {
+		c.Log.Warn("ipv6 detection failed, reporting none", "err", err)
+		return ""
+	}
+	return ip
+}
+
+// checkIPv6 probes IPv6 connectivity once IPv4 is online. The portal
+// authorizes both stacks with one login, so a failure is only reported.
+func (c *Client) checkIPv6() {
+	if c.IPv6Client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Ctx, time.Second*5)
+	defer cancel()
+
+	reachable := false
+	request, err := c.NewGetRequestWithCustomCtx(ctx, c.Config.IPv6Probe)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = c.IPv6Client.Do(request); err == nil {
+			_ = resp.Body.Close()
+			reachable = resp.StatusCode == http.StatusNoContent
+		}
+	}
+
+	if !c.ipv6Checked || c.Status().IPv6Reachable != reachable {
+		if reachable {
+			c.Log.Info("ipv6 reachable")
+		} else {
+			c.Log.Warn("ipv6 unreachable", "err", err)
+		}
+	}
+	c.ipv6Checked = true
+	c.updateStatus(func(s *Status) {
+		s.IPv6Reachable = reachable
+	})
+}
@@ -0,0 +1,46 @@
+package esurfing
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Attribute keys whose values are secrets. Handlers built by NewLogHandler
+// redact them unless LogOptions.ShowSecrets is set.
+const (
+	LogKeyPassword = "password"
+	LogKeyTicket   = "ticket"
+	LogKeyClientID = "client_id"
+)
+
+const redacted = "[redacted]"
+
+type LogOptions struct {
+	Level slog.Level
+	// JSON selects slog.JSONHandler instead of slog.TextHandler.
+	JSON bool
+	// ShowSecrets disables redaction, for debugging only.
+	ShowSecrets bool
+}
+
+func NewLogHandler(w io.Writer, o LogOptions) slog.Handler {
+	opts := &slog.HandlerOptions{Level: o.Level}
+	if !o.ShowSecrets {
+		opts.ReplaceAttr = redactSecrets
+	}
+
+	if o.JSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func redactSecrets(groups []string, a slog.Attr) slog.Attr {
+	switch a.Key {
+	case LogKeyPassword, LogKeyTicket, LogKeyClientID:
+		if a.Value.String() != "" {
+			a.Value = slog.StringValue(redacted)
+		}
+	}
+	return a
+}
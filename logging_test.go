@@ -0,0 +1,70 @@
+package esurfing
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogRedaction(t *testing.T) {
+	secrets := map[string]string{
+		LogKeyPassword: "secret-password",
+		LogKeyTicket:   "secret-ticket",
+		LogKeyClientID: "secret-client-id",
+	}
+	logs := []struct {
+		name string
+		log  func(l *slog.Logger, key, value string)
+	}{
+		{"attr", func(l *slog.Logger, key, value string) {
+			l.Info("msg", key, value)
+		}},
+		{"with", func(l *slog.Logger, key, value string) {
+			l.With(key, value).Info("msg")
+		}},
+		{"group", func(l *slog.Logger, key, value string) {
+			l.WithGroup("session").Info("msg", key, value)
+		}},
+	}
+
+	for _, json := range []bool{false, true} {
+		for _, show := range []bool{false, true} {
+			for _, lg := range logs {
+				for key, value := range secrets {
+					t.Run(fmt.Sprintf("json=%v/show=%v/%s/%s", json, show, lg.name, key), func(t *testing.T) {
+						var buf bytes.Buffer
+						l := slog.New(NewLogHandler(&buf, LogOptions{JSON: json, ShowSecrets: show}))
+						lg.log(l, key, value)
+
+						out := buf.String()
+						if strings.Contains(out, value) != show {
+							t.Fatalf("secret shown %v, want %v: %s", !show, show, out)
+						}
+						if strings.Contains(out, redacted) == show {
+							t.Fatalf("redacted %v, want %v: %s", show, !show, out)
+						}
+					})
+				}
+			}
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		//an empty secret stays empty, so a missing ticket is visible in the log
+		var buf bytes.Buffer
+		slog.New(NewLogHandler(&buf, LogOptions{})).Info("msg", LogKeyTicket, "")
+		if strings.Contains(buf.String(), redacted) {
+			t.Fatalf("empty value redacted: %s", buf.String())
+		}
+	})
+
+	t.Run("other keys", func(t *testing.T) {
+		var buf bytes.Buffer
+		slog.New(NewLogHandler(&buf, LogOptions{})).Info("msg", "user", "alice")
+		if !strings.Contains(buf.String(), "alice") {
+			t.Fatalf("non secret value redacted: %s", buf.String())
+		}
+	})
+}
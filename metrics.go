@@ -0,0 +1,53 @@
+package esurfing
+
+import (
+	"maps"
+	"time"
+)
+
+// Metrics are the counters and gauges a client keeps about its own health.
+// Counters only ever grow for the lifetime of the client.
+type Metrics struct {
+	// AuthAttempts and AuthFailures are keyed by Auth stage, e.g. "GetTicket".
+	AuthAttempts       map[string]uint64
+	AuthFailures       map[string]uint64
+	AuthSuccesses      uint64
+	HeartbeatSuccesses uint64
+	HeartbeatFailures  uint64
+	HeartbeatInterval  time.Duration
+	AlgoID             string
+	ProbeLatency       time.Duration
+	LastProbeSuccess   time.Time
+}
+
+func (c *Client) Metrics() Metrics {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	m := c.metrics
+	m.AuthAttempts = maps.Clone(c.metrics.AuthAttempts)
+	m.AuthFailures = maps.Clone(c.metrics.AuthFailures)
+	return m
+}
+
+func (c *Client) updateMetrics(update func(m *Metrics)) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	update(&c.metrics)
+}
+
+// stage runs one step of Auth, counting it and wrapping its failure in an
+// AuthError that names the step.
+func (c *Client) stage(name string, step func() error) error {
+	c.updateMetrics(func(m *Metrics) {
+		m.AuthAttempts[name]++
+	})
+
+	if err := step(); err != nil {
+		c.updateMetrics(func(m *Metrics) {
+			m.AuthFailures[name]++
+		})
+		return &AuthError{Stage: name, Err: err}
+	}
+	return nil
+}
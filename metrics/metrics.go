@@ -0,0 +1,133 @@
+// Package metrics exports the health of a running Group in the Prometheus
+// text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	esurfing "github.com/DreamwareN/Esurfing-go"
+)
+
+// Stages lists the Auth steps in flow order, so every account exports a
+// series per stage even before that stage has run.
+var Stages = []string{"GetSchoolInfo", "GetIdentity", "GetEConfig", "GetUserAndAcIP", "GetAlgoId", "GetTicket", "Login"}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+// Handler serves the metrics of every client in group.
+func Handler(group *esurfing.Group) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, f := range collect(group, time.Now()) {
+			f.write(bw)
+		}
+		_ = bw.Flush()
+	})
+}
+
+// ListenAndServe serves /metrics for group on addr until the server fails.
+func ListenAndServe(addr string, group *esurfing.Group) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler(group))
+	return http.ListenAndServe(addr, mux)
+}
+
+func collect(group *esurfing.Group, now time.Time) []*family {
+	authAttempts := &family{name: "esurfing_auth_attempts_total", kind: "counter", help: "Auth stage attempts."}
+	authFailures := &family{name: "esurfing_auth_failures_total", kind: "counter", help: "Auth stage failures."}
+	authSuccesses := &family{name: "esurfing_auth_successes_total", kind: "counter", help: "Completed auth flows."}
+	heartbeatSuccesses := &family{name: "esurfing_heartbeat_successes_total", kind: "counter", help: "Accepted heartbeats."}
+	heartbeatFailures := &family{name: "esurfing_heartbeat_failures_total", kind: "counter", help: "Failed heartbeats."}
+	heartbeatInterval := &family{name: "esurfing_heartbeat_interval_seconds", kind: "gauge", help: "Heartbeat interval requested by the portal."}
+	algo := &family{name: "esurfing_algo_info", kind: "gauge", help: "Negotiated algorithm ID."}
+	online := &family{name: "esurfing_online", kind: "gauge", help: "Whether the client is in the online phase."}
+	probeLatency := &family{name: "esurfing_probe_latency_seconds", kind: "gauge", help: "Duration of the last connectivity probe."}
+	sinceProbe := &family{name: "esurfing_last_probe_success_age_seconds", kind: "gauge", help: "Time since the last probe answered 204."}
+
+	for _, c := range group.Clients() {
+		status := c.Status()
+		m := c.Metrics()
+		labels := labelString("user", status.Username, "interface", status.BindInterface)
+
+		for _, stage := range stageNames(m) {
+			stageLabels := labelString("user", status.Username, "interface", status.BindInterface, "stage", stage)
+			authAttempts.add(stageLabels, float64(m.AuthAttempts[stage]))
+			authFailures.add(stageLabels, float64(m.AuthFailures[stage]))
+		}
+		authSuccesses.add(labels, float64(m.AuthSuccesses))
+		heartbeatSuccesses.add(labels, float64(m.HeartbeatSuccesses))
+		heartbeatFailures.add(labels, float64(m.HeartbeatFailures))
+		heartbeatInterval.add(labels, m.HeartbeatInterval.Seconds())
+		if m.AlgoID != "" {
+			algo.add(labelString("user", status.Username, "interface", status.BindInterface, "algo_id", m.AlgoID), 1)
+		}
+		online.add(labels, boolValue(status.Phase == esurfing.PhaseOnline))
+		probeLatency.add(labels, m.ProbeLatency.Seconds())
+		if !m.LastProbeSuccess.IsZero() {
+			sinceProbe.add(labels, now.Sub(m.LastProbeSuccess).Seconds())
+		}
+	}
+
+	return []*family{authAttempts, authFailures, authSuccesses, heartbeatSuccesses, heartbeatFailures,
+		heartbeatInterval, algo, online, probeLatency, sinceProbe}
+}
+
+func stageNames(m esurfing.Metrics) []string {
+	stages := slices.Clone(Stages)
+	for stage := range m.AuthAttempts {
+		if !slices.Contains(stages, stage) {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+func (f *family) add(labels string, value float64) {
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, s := range f.samples {
+		_, _ = fmt.Fprintf(w, "%s{%s} %g\n", f.name, s.labels, s.value)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelString(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package esurfing
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DreamwareN/Esurfing-go/protocol"
+)
+
+// Policy is what the portal tells the client about the account beyond the
+// session itself, from the login response and every heartbeat.
+type Policy struct {
+	// Level is the account level of the last heartbeat, 0 for a normal account.
+	Level int `json:"level"`
+	// AgainstInterval is the anti-sharing check interval in seconds, 0 if
+	// not sent. Heartbeats are never spaced further apart than this.
+	AgainstInterval int `json:"against_interval,omitempty"`
+	// DomainConfig is passed on as sent, its format is not documented.
+	DomainConfig string `json:"domain_config,omitempty"`
+}
+
+// applyLoginPolicy takes over the user and domain config of a login response.
+func (c *Client) applyLoginPolicy(resp *protocol.LoginResponse) {
+	c.Policy.AgainstInterval = 0
+	if value := strings.TrimSpace(resp.UserConfig.AgainstInterval); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			c.Log.Warn("ignoring invalid against-interval", "value", value)
+		} else {
+			c.Policy.AgainstInterval = seconds
+		}
+	}
+	c.Policy.DomainConfig = strings.TrimSpace(resp.DomainConfig)
+	c.Log.Debug("portal policy", "against_interval", c.Policy.AgainstInterval, "domain_config", c.Policy.DomainConfig)
+	c.syncStatus()
+}
+
+// applyLevel takes over the level of a heartbeat response and warns when it
+// changes, which is how the portal flags a restricted account.
+func (c *Client) applyLevel(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil {
+		c.Log.Warn("ignoring invalid level", "value", value)
+		return
+	}
+	if level == c.Policy.Level {
+		return
+	}
+
+	if level != 0 {
+		c.Log.Warn("account level changed", "level", level, "previous", c.Policy.Level)
+	} else {
+		c.Log.Info("account level back to normal", "previous", c.Policy.Level)
+	}
+	c.Policy.Level = level
+	c.syncStatus()
+}
+
+// limitInterval caps a heartbeat interval at the against-interval.
+func (c *Client) limitInterval(interval time.Duration) time.Duration {
+	if c.Policy.AgainstInterval > 0 {
+		return min(interval, time.Duration(c.Policy.AgainstInterval)*time.Second)
+	}
+	return interval
+}
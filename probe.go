@@ -0,0 +1,175 @@
+package esurfing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DreamwareN/Esurfing-go/trace"
+)
+
+const (
+	DefaultProbeURL = "http://connect.rom.miui.com/generate_204"
+	probeTimeout    = 10 * time.Second
+	//body checks only need the start of a page
+	probeBodyLimit = 64 << 10
+)
+
+type probeOutcome int
+
+const (
+	probeOnline probeOutcome = iota
+	// probeCaptive is a redirect to the login page.
+	probeCaptive
+	// probeUnexpected answered, but not with what a working network returns.
+	probeUnexpected
+	// probeUnreachable did not answer at all.
+	probeUnreachable
+)
+
+type probeResult struct {
+	probe   Probe
+	outcome probeOutcome
+	resp    *http.Response
+	err     error
+}
+
+// probeConfig returns the configured probes with defaults filled in.
+func probeConfig(config *Config) ([]Probe, int, error) {
+	list := config.Probes
+	if len(list) == 0 {
+		list = []Probe{{URL: DefaultProbeURL}}
+	}
+
+	out := make([]Probe, 0, len(list))
+	for _, p := range list {
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, 0, errors.New("invalid probe url: " + p.URL)
+		}
+		if p.Status == 0 {
+			p.Status = http.StatusNoContent
+		}
+		out = append(out, p)
+	}
+
+	quorum := config.ProbeQuorum
+	if quorum == 0 {
+		quorum = len(out)/2 + 1
+	}
+	if quorum < 0 || quorum > len(out) {
+		return nil, 0, fmt.Errorf("probe_quorum %d out of range 1..%d", quorum, len(out))
+	}
+	return out, quorum, nil
+}
+
+// runProbes checks every probe at once and returns the results in config order.
+func (c *Client) runProbes(ctx context.Context) []probeResult {
+	results := make([]probeResult, len(c.probes))
+	var wg sync.WaitGroup
+	for i, p := range c.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.probe(ctx, p)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *Client) probe(ctx context.Context, p Probe) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	ctx = trace.WithNote(ctx, &trace.Note{Probe: &trace.Probe{Status: p.Status, Body: p.Body, Quorum: c.probeQuorum}})
+
+	result := probeResult{probe: p, outcome: probeUnreachable}
+	request, err := c.NewGetRequestWithCustomCtx(ctx, p.URL)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	resp, err := c.HttpClient.Do(request)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	result.resp = resp
+
+	switch {
+	case resp.StatusCode == p.Status:
+		if p.Body == "" {
+			result.outcome = probeOnline
+			return result
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+		if err != nil {
+			result.err = err
+			return result
+		}
+		if !strings.Contains(string(body), p.Body) {
+			//answered with the right status but someone else's page
+			result.outcome = probeUnexpected
+			result.err = errors.New("body does not contain " + p.Body)
+			return result
+		}
+		result.outcome = probeOnline
+	case resp.StatusCode == http.StatusFound && resp.Header.Get("Location") != "":
+		result.outcome = probeCaptive
+	default:
+		result.outcome = probeUnexpected
+		result.err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return result
+}
+
+// probeVerdict is what a round of probes says about the network.
+type probeVerdict struct {
+	online bool
+	// redirect is the first captive redirect, nil when there was none.
+	redirect *http.Response
+	err      error
+}
+
+func (c *Client) judgeProbes(results []probeResult) probeVerdict {
+	online, unreachable := 0, 0
+	var redirect *http.Response
+	var errs []string
+	for _, r := range results {
+		switch r.outcome {
+		case probeOnline:
+			online++
+		case probeCaptive:
+			if redirect == nil {
+				redirect = r.resp
+			}
+		case probeUnreachable:
+			unreachable++
+			fallthrough
+		default:
+			c.Log.Debug("probe failed", "url", r.probe.URL, "err", r.err)
+			errs = append(errs, r.probe.URL+": "+r.err.Error())
+		}
+	}
+
+	switch {
+	case online >= c.probeQuorum:
+		return probeVerdict{online: true}
+	case redirect != nil:
+		return probeVerdict{redirect: redirect}
+	case unreachable == len(results):
+		return probeVerdict{err: fmt.Errorf("%w: %s", ErrProbeUnreachable, strings.Join(errs, "; "))}
+	default:
+		return probeVerdict{err: fmt.Errorf("%d of %d probes online, %d needed: %s",
+			online, len(results), c.probeQuorum, strings.Join(errs, "; "))}
+	}
+}
@@ -0,0 +1,72 @@
+package esurfing
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+)
+
+func TestJudgeProbes(t *testing.T) {
+	online := func() probeResult {
+		return probeResult{probe: Probe{URL: "http://online/"}, outcome: probeOnline}
+	}
+	captive := func(location string) probeResult {
+		resp := &http.Response{StatusCode: http.StatusFound, Header: http.Header{"Location": {location}}}
+		return probeResult{probe: Probe{URL: "http://captive/"}, outcome: probeCaptive, resp: resp}
+	}
+	unexpected := func() probeResult {
+		return probeResult{probe: Probe{URL: "http://unexpected/"}, outcome: probeUnexpected, err: errors.New("unexpected status code: 200")}
+	}
+	unreachable := func() probeResult {
+		return probeResult{probe: Probe{URL: "http://unreachable/"}, outcome: probeUnreachable, err: errors.New("connection refused")}
+	}
+
+	tests := []struct {
+		name    string
+		quorum  int
+		results []probeResult
+		online  bool
+		// redirect is the Location of the expected redirect, empty for none.
+		redirect string
+		// err is whether the round fails, unreachable whether it fails with
+		// ErrProbeUnreachable.
+		err, unreachable bool
+	}{
+		{name: "single online", quorum: 1, results: []probeResult{online()}, online: true},
+		{name: "quorum met", quorum: 2, results: []probeResult{online(), unreachable(), online()}, online: true},
+		{name: "quorum met despite a redirect", quorum: 2, results: []probeResult{online(), captive("http://portal/a"), online()}, online: true},
+		{name: "single redirect", quorum: 1, results: []probeResult{captive("http://portal/a")}, redirect: "http://portal/a"},
+		{name: "1 of 3 redirect, 2 unreachable", quorum: 2, results: []probeResult{unreachable(), captive("http://portal/a"), unreachable()}, redirect: "http://portal/a"},
+		{name: "redirect below quorum", quorum: 2, results: []probeResult{online(), captive("http://portal/a"), unexpected()}, redirect: "http://portal/a"},
+		{name: "first redirect wins", quorum: 2, results: []probeResult{captive("http://portal/a"), captive("http://portal/b")}, redirect: "http://portal/a"},
+		{name: "all unreachable", quorum: 2, results: []probeResult{unreachable(), unreachable(), unreachable()}, err: true, unreachable: true},
+		{name: "quorum > online", quorum: 3, results: []probeResult{online(), online(), unexpected()}, err: true},
+		{name: "quorum > online, rest unreachable", quorum: 2, results: []probeResult{online(), unreachable(), unreachable()}, err: true},
+		{name: "unexpected", quorum: 1, results: []probeResult{unexpected()}, err: true},
+		{name: "unexpected and unreachable", quorum: 1, results: []probeResult{unexpected(), unreachable()}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Log: slog.New(slog.DiscardHandler), probeQuorum: tt.quorum}
+			v := c.judgeProbes(tt.results)
+
+			if v.online != tt.online {
+				t.Errorf("online %v, want %v", v.online, tt.online)
+			}
+			var redirect string
+			if v.redirect != nil {
+				redirect = v.redirect.Header.Get("Location")
+			}
+			if redirect != tt.redirect {
+				t.Errorf("redirect %q, want %q", redirect, tt.redirect)
+			}
+			if (v.err != nil) != tt.err {
+				t.Fatalf("err %v, want error %v", v.err, tt.err)
+			}
+			if errors.Is(v.err, ErrProbeUnreachable) != tt.unreachable {
+				t.Errorf("err %v, want ErrProbeUnreachable %v", v.err, tt.unreachable)
+			}
+		})
+	}
+}
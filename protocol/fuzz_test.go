@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func FuzzDecodeAlgoID(f *testing.F) {
+	f.Add([]byte("\x00\x00\x00\x00\x245BFBA864-BBA9-42DB-8EAD-49B5F412BD81"))
+	f.Add([]byte("\x00\x00\x00\x04abcd\x24F3974434-C0DD-4C20-9E87-DDB6814A1C48"))
+	f.Add([]byte("\x00\x00\x00\xff"))
+	f.Add([]byte("\x00\x00\x00\x00"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		algoID, key, err := DecodeAlgoID(data)
+		if err != nil {
+			return
+		}
+		n := int(data[3])
+		if key != string(data[4:4+n]) {
+			t.Fatalf("key %q is not the %d bytes after the header", key, n)
+		}
+		if len(algoID) != int(data[4+n]) {
+			t.Fatalf("algo id %q does not have the announced length %d", algoID, data[4+n])
+		}
+	})
+}
+
+func FuzzFormatEConfig(f *testing.F) {
+	f.Add([]byte(`<html><!--//config.campus.js.chinatelecom.com <config><ticket-url><![CDATA[http://portal/ticket?a=1&width=0]]></ticket-url></config>//config.campus.js.chinatelecom.com--></html>`))
+	f.Add([]byte(ConfigStartTag))
+	f.Add([]byte(ConfigEndTag + ConfigStartTag))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		config, err := FormatEConfig(data)
+		if err != nil {
+			return
+		}
+		start := bytes.Index(data, []byte(ConfigStartTag))
+		if start < 0 || !bytes.Contains(data[start+len(ConfigStartTag):], []byte(ConfigEndTag)) {
+			t.Fatalf("accepted %q without both markers", data)
+		}
+		if len(config) > len(data)-len(ConfigStartTag)-len(ConfigEndTag) {
+			t.Fatalf("config %q is longer than what lies between the markers", config)
+		}
+	})
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte(`<response><ticket>abc</ticket><expire>86400</expire><code>0</code></response>`))
+	f.Add([]byte(`<response><keep-retry>600</keep-retry><keep-url>http://a/keep</keep-url><user-config><against-interval>30</against-interval></user-config></response>`))
+	f.Add([]byte(`<response><interval>600</interval><level>2</level></response>`))
+	f.Add([]byte(`<config><ticket-url><![CDATA[http://a/ticket]]></ticket-url><auth-url>http://a/auth</auth-url></config>`))
+	f.Add([]byte(`<request><user-agent>x</user-agent><ticket>t</ticket></request>`))
+	f.Add([]byte(`<response><code>`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, v := range []any{
+			&TicketRequest{}, &TicketResponse{}, &LoginRequest{}, &LoginResponse{},
+			&State{}, &StateResponse{}, &EConfig{},
+		} {
+			if err := xml.Unmarshal(data, v); err != nil {
+				continue
+			}
+			//whatever was accepted has to survive being sent back
+			if _, err := xml.Marshal(v); err != nil {
+				t.Fatalf("marshal %T after unmarshal of %q: %v", v, data, err)
+			}
+		}
+	})
+}
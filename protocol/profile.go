@@ -0,0 +1,55 @@
+package protocol
+
+import (
+	"sort"
+	"strings"
+)
+
+// OstagHostname in a profile's Ostag is replaced by the device hostname.
+const OstagHostname = "{hostname}"
+
+// Profile is the fingerprint of one official client, what a school may
+// whitelist on.
+type Profile struct {
+	Name string
+	// UserAgent is sent both as header and as <user-agent> in every request.
+	UserAgent string
+	Accept    string
+	// Ostag is the <ostag> value, OstagHostname is replaced by the hostname.
+	Ostag string
+}
+
+func (p Profile) FormatOstag(hostname string) string {
+	return strings.ReplaceAll(p.Ostag, OstagHostname, hostname)
+}
+
+const ProfileAndroid = "android"
+
+// profiles holds only clients checked against captures, a client that has
+// not been captured yet is configured field by field instead.
+var profiles = map[string]Profile{
+	ProfileAndroid: {
+		Name:      ProfileAndroid,
+		UserAgent: UserAgentAndroid,
+		Accept:    "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*",
+		Ostag:     OstagHostname,
+	},
+}
+
+// LookupProfile returns the named profile; an empty name is android.
+func LookupProfile(name string) (Profile, bool) {
+	if name == "" {
+		name = ProfileAndroid
+	}
+	p, ok := profiles[name]
+	return p, ok
+}
+
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+)
+
+func DecodeAlgoID(data []byte) (algoID string, key string, err error) {
+	dataLen := len(data)
+	if dataLen < 4 {
+		return "", "", errors.New("data Error: insufficient header length")
+	}
+
+	len1 := int(data[3])
+	pos := 4
+
+	if pos+len1 > dataLen {
+		return "", "", errors.New("data Error: key length exceeds data size")
+	}
+	keyBytes := data[pos : pos+len1]
+	pos += len1
+
+	if pos >= dataLen {
+		return "", "", errors.New("data Error: missing algoID header")
+	}
+
+	len2 := int(data[pos])
+	pos++
+
+	if pos+len2 > dataLen {
+		return "", "", errors.New("data Error: algoID length exceeds data size")
+	}
+	algoIDBytes := data[pos : pos+len2]
+
+	return string(algoIDBytes), string(keyBytes), nil
+}
+
+const ConfigStartTag = "<!--//config.campus.js.chinatelecom.com "
+const ConfigEndTag = "//config.campus.js.chinatelecom.com-->"
+
+// FormatEConfig extracts the config XML the index page carries inside an
+// HTML comment.
+func FormatEConfig(data []byte) ([]byte, error) {
+	_, rest, found := strings.Cut(string(data), ConfigStartTag)
+	if !found {
+		return nil, errors.New("data Error: config start marker not found")
+	}
+	config, _, found := strings.Cut(rest, ConfigEndTag)
+	if !found {
+		return nil, errors.New("data Error: config end marker not found")
+	}
+
+	config = strings.ReplaceAll(config, "&width=0", "")
+	config = strings.ReplaceAll(config, "&adtype=0", "")
+
+	return []byte(config), nil
+}
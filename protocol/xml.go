@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"encoding/xml"
+)
+
+const (
+	UserAgentAndroid = "CCTP/android64_vpn/2093"
+	XMLHeader        = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>"
+	ZeroAlgoID       = "00000000-0000-0000-0000-000000000000"
+)
+
+type TicketRequest struct {
+	XMLName   xml.Name `xml:"request"`
+	Text      string   `xml:",chardata"`
+	UserAgent string   `xml:"user-agent"`
+	ClientID  string   `xml:"client-id"`
+	LocalTime string   `xml:"local-time"`
+	HostName  string   `xml:"host-name"`
+	Ipv4      string   `xml:"ipv4"`
+	Ipv6      string   `xml:"ipv6"`
+	Mac       string   `xml:"mac"`
+	Ostag     string   `xml:"ostag"`
+	Gwip      string   `xml:"gwip"`
+}
+
+type TicketResponse struct {
+	XMLName xml.Name `xml:"response"`
+	Text    string   `xml:",chardata"`
+	Ticket  string   `xml:"ticket"`
+	Expire  string   `xml:"expire"`
+	Code    string   `xml:"code"`
+	Message string   `xml:"message"`
+}
+
+type LoginRequest struct {
+	XMLName   xml.Name `xml:"request"`
+	Text      string   `xml:",chardata"`
+	UserAgent string   `xml:"user-agent"`
+	ClientID  string   `xml:"client-id"`
+	Ticket    string   `xml:"ticket"`
+	LocalTime string   `xml:"local-time"`
+	Userid    string   `xml:"userid"`
+	Passwd    string   `xml:"passwd"`
+}
+
+type LoginResponse struct {
+	XMLName    xml.Name `xml:"response"`
+	Text       string   `xml:",chardata"`
+	Userid     string   `xml:"userid"`
+	KeepRetry  string   `xml:"keep-retry"`
+	KeepURL    string   `xml:"keep-url"`
+	TermURL    string   `xml:"term-url"`
+	UserConfig struct {
+		Text            string `xml:",chardata"`
+		AgainstInterval string `xml:"against-interval"`
+	} `xml:"user-config"`
+	DomainConfig string `xml:"domain-config"`
+	Code         string `xml:"code"`
+	Message      string `xml:"message"`
+}
+
+type State struct {
+	XMLName   xml.Name `xml:"request"`
+	Text      string   `xml:",chardata"`
+	UserAgent string   `xml:"user-agent"`
+	ClientID  string   `xml:"client-id"`
+	LocalTime string   `xml:"local-time"`
+	HostName  string   `xml:"host-name"`
+	Ipv4      string   `xml:"ipv4"`
+	Ticket    string   `xml:"ticket"`
+	Ipv6      string   `xml:"ipv6"`
+	Mac       string   `xml:"mac"`
+	Ostag     string   `xml:"ostag"`
+}
+
+type StateResponse struct {
+	XMLName  xml.Name `xml:"response"`
+	Text     string   `xml:",chardata"`
+	Interval string   `xml:"interval"`
+	Level    string   `xml:"level"`
+	Code     string   `xml:"code"`
+	Message  string   `xml:"message"`
+}
+
+type EConfig struct {
+	XMLName   xml.Name `xml:"config"`
+	Text      string   `xml:",chardata"`
+	TicketURL string   `xml:"ticket-url"`
+	AuthURL   string   `xml:"auth-url"`
+	//delete useless field
+}
@@ -1,4 +1,4 @@
-package main
+package esurfing
 
 import (
 	"bytes"
@@ -9,13 +9,17 @@ import (
 )
 
 func (c *Client) NewGetRequest(url string) (request *http.Request, err error) {
-	req, err := http.NewRequestWithContext(c.Ctx, http.MethodGet, url, nil)
+	return c.NewGetRequestWithCustomCtx(c.Ctx, url)
+}
+
+func (c *Client) NewGetRequestWithCustomCtx(ctx context.Context, url string) (request *http.Request, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", UserAgentAndroid)
-	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
+	req.Header.Set("User-Agent", c.Profile.UserAgent)
+	req.Header.Set("Accept", c.Profile.Accept)
 	req.Header.Set("Client-ID", c.ClientID.String())
 	req.Header.Set("Connection", "keep-alive")
 	if c.SchoolID != "" {
@@ -32,18 +36,7 @@ func (c *Client) NewGetRequest(url string) (request *http.Request, err error) {
 }
 
 func (c *Client) NewPostRequest(url string, data []byte) (request *http.Request, err error) {
-	md5Hex := md5.Sum(data)
-
-	req, err := http.NewRequestWithContext(c.Ctx, http.MethodPost, url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", UserAgentAndroid)
-	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
-	req.Header.Set("Client-ID", c.ClientID.String())
-	req.Header.Set("CDC-Checksum", hex.EncodeToString(md5Hex[:]))
-	req.Header.Set("Algo-ID", c.AlgoID)
-	return req, nil
+	return c.NewPostRequestWithCustomCtx(c.Ctx, url, data)
 }
 
 func (c *Client) NewPostRequestWithCustomCtx(ctx context.Context, url string, data []byte) (request *http.Request, err error) {
@@ -53,8 +46,8 @@ func (c *Client) NewPostRequestWithCustomCtx(ctx context.Context, url string, da
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", UserAgentAndroid)
-	req.Header.Set("Accept", "text/html,text/xml,application/xhtml+xml,application/x-javascript,*/*")
+	req.Header.Set("User-Agent", c.Profile.UserAgent)
+	req.Header.Set("Accept", c.Profile.Accept)
 	req.Header.Set("Client-ID", c.ClientID.String())
 	req.Header.Set("CDC-Checksum", hex.EncodeToString(md5Hex[:]))
 	req.Header.Set("Algo-ID", c.AlgoID)
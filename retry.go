@@ -0,0 +1,60 @@
+package esurfing
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// retryJitter is the fraction of each backoff delay that is randomized, so
+// accounts that failed together do not retry in lockstep.
+const retryJitter = 0.2
+
+type backoff struct {
+	base        time.Duration
+	max         time.Duration
+	maxAttempts int
+	attempts    int
+}
+
+func newBackoff(config *Config) *backoff {
+	return &backoff{
+		base:        time.Millisecond * time.Duration(config.RetryInterval),
+		max:         time.Millisecond * time.Duration(config.RetryMaxInterval),
+		maxAttempts: config.RetryMaxAttempts,
+	}
+}
+
+// Next records a failed attempt and returns the delay before the next one.
+// It returns false when the client should give up.
+func (b *backoff) Next() (time.Duration, bool) {
+	b.attempts++
+	if b.base < 0 {
+		return 0, false
+	}
+	if b.maxAttempts > 0 && b.attempts >= b.maxAttempts {
+		return 0, false
+	}
+
+	delay := b.base
+	for i := 1; i < b.attempts && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+
+	spread := time.Duration(float64(delay) * retryJitter)
+	if spread > 0 {
+		delay += time.Duration(rand.Int64N(int64(2*spread))) - spread
+	}
+	//jitter spreads the retries below the cap, never above it
+	return min(delay, b.max), true
+}
+
+func (b *backoff) Attempts() int {
+	return b.attempts
+}
+
+func (b *backoff) Reset() {
+	b.attempts = 0
+}
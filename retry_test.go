@@ -0,0 +1,87 @@
+package esurfing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(&Config{RetryInterval: 1000, RetryMaxInterval: 10000})
+	//1s doubling up to the 10s cap
+	want := []time.Duration{1, 2, 4, 8, 10, 10, 10}
+	for i, w := range want {
+		w *= time.Second
+		delay, ok := b.Next()
+		if !ok {
+			t.Fatalf("attempt %d: gave up without a limit", i+1)
+		}
+		low := w - time.Duration(float64(w)*retryJitter)
+		high := min(w+time.Duration(float64(w)*retryJitter), 10*time.Second)
+		if delay < low || delay > high {
+			t.Fatalf("attempt %d: delay %v outside %v..%v", i+1, delay, low, high)
+		}
+		if b.Attempts() != i+1 {
+			t.Fatalf("attempt %d: Attempts() = %d", i+1, b.Attempts())
+		}
+	}
+
+	b.Reset()
+	if delay, _ := b.Next(); delay > 1200*time.Millisecond {
+		t.Fatalf("delay %v after reset, want the base interval", delay)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := newBackoff(&Config{RetryInterval: 1000, RetryMaxInterval: 1000})
+	seen := map[time.Duration]bool{}
+	for range 100 {
+		delay, _ := b.Next()
+		if delay < 800*time.Millisecond || delay > time.Second {
+			t.Fatalf("delay %v outside 800ms..1s", delay)
+		}
+		seen[delay] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("only %d distinct delays in 100 attempts, jitter is missing", len(seen))
+	}
+}
+
+// TestBackoffMaxAttempts checks that retry_max_attempts counts logins, the
+// first one included: with 3 the client logs in 3 times, retrying twice.
+func TestBackoffMaxAttempts(t *testing.T) {
+	b := newBackoff(&Config{RetryInterval: 1000, RetryMaxInterval: 1000, RetryMaxAttempts: 3})
+	for i := 1; i <= 2; i++ {
+		if _, ok := b.Next(); !ok {
+			t.Fatalf("gave up after %d failed logins, want 3", i)
+		}
+	}
+	if _, ok := b.Next(); ok {
+		t.Fatal("retries after 3 failed logins")
+	}
+	if b.Attempts() != 3 {
+		t.Fatalf("Attempts() = %d, want 3", b.Attempts())
+	}
+}
+
+func TestBackoffNoRetry(t *testing.T) {
+	b := newBackoff(&Config{RetryInterval: -1})
+	if _, ok := b.Next(); ok {
+		t.Fatal("retries with a negative retry_interval")
+	}
+	if b.Attempts() != 1 {
+		t.Fatalf("Attempts() = %d, want 1", b.Attempts())
+	}
+}
+
+// TestBackoffDefaults checks the intervals NewClient hands to the backoff.
+func TestBackoffDefaults(t *testing.T) {
+	c, err := NewClient(&Config{Username: "user", Password: "pass", RetryInterval: 5000, RetryMaxInterval: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cancel()
+	//a cap below the base is raised to it
+	if c.backoff.max != 5*time.Second {
+		t.Fatalf("max %v, want the 5s base", c.backoff.max)
+	}
+}
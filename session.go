@@ -0,0 +1,185 @@
+package esurfing
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DreamwareN/Esurfing-go/cipher"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+	"github.com/google/uuid"
+)
+
+// Session is everything needed to keep heartbeating an authorized session
+// without running Auth again.
+type Session struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	Hostname   string    `json:"hostname"`
+	MacAddress string    `json:"mac_address"`
+	Ticket     string    `json:"ticket"`
+	// TicketExpiry is zero when the portal sent no expiry.
+	TicketExpiry time.Time `json:"ticket_expiry,omitzero"`
+	Policy       Policy    `json:"policy,omitzero"`
+	AlgoID       string    `json:"algo_id"`
+	AlgoKey      []byte    `json:"algo_key,omitempty"`
+	UserIP       string    `json:"user_ip"`
+	UserIPv6     string    `json:"user_ipv6,omitempty"`
+	AcIP         string    `json:"ac_ip"`
+	Domain       string    `json:"domain"`
+	Area         string    `json:"area"`
+	SchoolID     string    `json:"school_id"`
+	KeepUrl      string    `json:"keep_url"`
+	TermUrl      string    `json:"term_url"`
+	// TicketUrl and AuthUrl let a resumed session refresh its ticket.
+	TicketUrl string    `json:"ticket_url,omitempty"`
+	AuthUrl   string    `json:"auth_url,omitempty"`
+	SavedAt   time.Time `json:"saved_at"`
+}
+
+func (c *Client) Session() Session {
+	return Session{
+		ClientID:     c.ClientID,
+		Hostname:     c.Hostname,
+		MacAddress:   c.MacAddress,
+		Ticket:       c.Ticket,
+		TicketExpiry: c.TicketExpiry,
+		Policy:       c.Policy,
+		AlgoID:       c.AlgoID,
+		AlgoKey:      c.AlgoKey,
+		UserIP:       c.UserIP,
+		UserIPv6:     c.UserIPv6,
+		AcIP:         c.AcIP,
+		Domain:       c.Domain,
+		Area:         c.Area,
+		SchoolID:     c.SchoolID,
+		KeepUrl:      c.KeepUrl,
+		TermUrl:      c.TermUrl,
+		TicketUrl:    c.TicketUrl,
+		AuthUrl:      c.AuthUrl,
+	}
+}
+
+func (c *Client) RestoreSession(s Session) error {
+	ci, err := cipher.NewCipherWithKey(s.AlgoID, s.AlgoKey)
+	if err != nil {
+		return errors.New("AlgoID " + s.AlgoID + ": " + err.Error())
+	}
+	if s.Ticket == "" || s.KeepUrl == "" {
+		return errors.New("session has no ticket or keep url")
+	}
+
+	c.applySession(s)
+	c.cipher = ci
+	return nil
+}
+
+func (c *Client) saveSession() error {
+	if c.Config.StateFile == "" {
+		return nil
+	}
+
+	s := c.Session()
+	s.SavedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//write then rename so a crash mid-write never leaves a truncated file
+	if err = os.MkdirAll(filepath.Dir(c.Config.StateFile), 0700); err != nil {
+		return err
+	}
+	tmp := c.Config.StateFile + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Config.StateFile)
+}
+
+func (c *Client) loadSession() (Session, error) {
+	var s Session
+	data, err := os.ReadFile(c.Config.StateFile)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+func (c *Client) clearSession() {
+	if c.Config.StateFile == "" {
+		return
+	}
+	if err := os.Remove(c.Config.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.Log.Warn("remove state file error", "err", err)
+	}
+}
+
+// resumeSession restores the saved session and proves it is still alive with a
+// heartbeat. It returns false when there is nothing to resume or the portal no
+// longer accepts the session, in which case the normal auth flow takes over.
+// A heartbeat that did not reach the portal is returned as error and keeps the
+// state file, so the next check can try again.
+func (c *Client) resumeSession() (bool, error) {
+	if c.Config.StateFile == "" {
+		return false, nil
+	}
+
+	s, err := c.loadSession()
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err == nil {
+		err = c.RestoreSession(s)
+	}
+	if err == nil {
+		err = c.SendHeartbeat()
+		var portalErr *PortalError
+		if err != nil && !errors.As(err, &portalErr) && !errors.Is(err, ErrTicketExpired) {
+			c.Log.Warn("resume session failed, trying again on the next check", "err", err)
+			c.resetSession()
+			return false, err
+		}
+	}
+	if err != nil {
+		c.Log.Warn("resume session failed", "err", err)
+		c.resetSession()
+		c.clearSession()
+		return false, nil
+	}
+
+	c.syncStatus()
+	c.updateMetrics(func(m *Metrics) {
+		m.AlgoID = c.AlgoID
+	})
+	c.Log.Info("session resumed", "algo_id", c.AlgoID, LogKeyClientID, c.ClientID)
+	return true, nil
+}
+
+func (c *Client) resetSession() {
+	c.applySession(Session{AlgoID: protocol.ZeroAlgoID})
+	c.cipher = nil
+}
+
+func (c *Client) applySession(s Session) {
+	c.ClientID = s.ClientID
+	c.Hostname = s.Hostname
+	c.MacAddress = s.MacAddress
+	c.Ticket = s.Ticket
+	c.TicketExpiry = s.TicketExpiry
+	c.Policy = s.Policy
+	c.AlgoID = s.AlgoID
+	c.AlgoKey = s.AlgoKey
+	c.UserIP = s.UserIP
+	c.UserIPv6 = s.UserIPv6
+	c.AcIP = s.AcIP
+	c.Domain = s.Domain
+	c.Area = s.Area
+	c.SchoolID = s.SchoolID
+	c.KeepUrl = s.KeepUrl
+	c.TermUrl = s.TermUrl
+	c.TicketUrl = s.TicketUrl
+	c.AuthUrl = s.AuthUrl
+}
@@ -0,0 +1,171 @@
+package esurfing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heartbeatDisabled parks the heartbeat ticker while there is no session.
+const heartbeatDisabled = time.Duration(math.MaxInt64)
+
+type Phase string
+
+const (
+	PhaseStarting       Phase = "starting"
+	PhaseAuthenticating Phase = "authenticating"
+	PhaseOnline         Phase = "online"
+	PhaseOffline        Phase = "offline"
+	PhaseWaitingRetry   Phase = "waiting_retry"
+	// PhaseWaitingInterface means the bound interface is down or has no address.
+	PhaseWaitingInterface Phase = "waiting_interface"
+	PhasePaused           Phase = "paused"
+	PhaseStopped          Phase = "stopped"
+)
+
+// Status is a snapshot of what a client is doing, safe to read from any
+// goroutine through Client.Status.
+type Status struct {
+	Username      string `json:"username"`
+	BindInterface string `json:"bind_interface"`
+	Phase         Phase  `json:"phase"`
+	UserIP        string `json:"user_ip,omitempty"`
+	UserIPv6      string `json:"user_ipv6,omitempty"`
+	// IPv6Reachable is the result of the last IPv6 probe, if one is configured.
+	IPv6Reachable bool      `json:"ipv6_reachable,omitempty"`
+	AcIP          string    `json:"ac_ip,omitempty"`
+	AlgoID        string    `json:"algo_id,omitempty"`
+	TicketExpiry  time.Time `json:"ticket_expiry,omitzero"`
+	Policy        Policy    `json:"policy,omitzero"`
+	LastHeartbeat time.Time `json:"last_heartbeat,omitzero"`
+	NextHeartbeat time.Time `json:"next_heartbeat,omitzero"`
+	NextRetry     time.Time `json:"next_retry,omitzero"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitzero"`
+}
+
+type Command string
+
+const (
+	// CommandCheck runs a connectivity check now, authenticating if needed.
+	CommandCheck Command = "check"
+	// CommandReauth logs the current session out and authenticates again.
+	CommandReauth Command = "reauth"
+	// CommandLogout logs the current session out and pauses the client.
+	CommandLogout Command = "logout"
+	// CommandPause stops checks and re-auth; a live session keeps heartbeating.
+	CommandPause Command = "pause"
+	// CommandResume undoes pause or logout and checks immediately.
+	CommandResume Command = "resume"
+)
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrClientStopped  = errors.New("client is stopped")
+)
+
+type commandRequest struct {
+	command Command
+	done    chan struct{}
+}
+
+func (c *Client) Status() Status {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.status
+}
+
+// Do hands a command to the client's loop and waits until it has been carried
+// out, so a following Status call reflects its outcome.
+func (c *Client) Do(command Command) error {
+	switch command {
+	case CommandCheck, CommandReauth, CommandLogout, CommandPause, CommandResume:
+	default:
+		return ErrUnknownCommand
+	}
+
+	req := commandRequest{command: command, done: make(chan struct{})}
+	select {
+	case c.commands <- req:
+	case <-c.done:
+		return ErrClientStopped
+	}
+
+	select {
+	case <-req.done:
+		return nil
+	case <-c.done:
+		return ErrClientStopped
+	}
+}
+
+func (c *Client) updateStatus(update func(s *Status)) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	update(&c.status)
+}
+
+func (c *Client) setPhase(phase Phase) {
+	c.updateStatus(func(s *Status) {
+		s.Phase = phase
+		if phase != PhaseWaitingRetry {
+			s.NextRetry = time.Time{}
+		}
+	})
+}
+
+func (c *Client) setError(err error) {
+	c.updateStatus(func(s *Status) {
+		s.LastError = err.Error()
+		s.LastErrorAt = time.Now()
+	})
+}
+
+// syncStatus copies the session fields owned by the client loop into the
+// shared status.
+func (c *Client) syncStatus() {
+	userIP, userIPv6, acIP, algoID := c.UserIP, c.UserIPv6, c.AcIP, c.AlgoID
+	ticketExpiry, policy := c.TicketExpiry, c.Policy
+	c.updateStatus(func(s *Status) {
+		s.TicketExpiry = ticketExpiry
+		s.Policy = policy
+		s.UserIP = userIP
+		s.UserIPv6 = userIPv6
+		s.AcIP = acIP
+		s.AlgoID = algoID
+	})
+}
+
+// maxHeartbeatInterval bounds the interval a portal may ask for, a day is
+// far beyond anything a real one sends.
+const maxHeartbeatInterval = 24 * time.Hour
+
+// parseInterval parses a heartbeat interval in seconds as sent by the portal.
+func parseInterval(value string) (time.Duration, error) {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid heartbeat interval %q", value)
+	}
+	//checked before converting, a huge value would overflow into a negative duration
+	if seconds <= 0 || seconds > int(maxHeartbeatInterval/time.Second) {
+		return 0, fmt.Errorf("heartbeat interval %q out of range", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (c *Client) scheduleHeartbeat(interval time.Duration) {
+	c.heartBeatTicker.Reset(interval)
+	c.updateStatus(func(s *Status) {
+		s.NextHeartbeat = time.Now().Add(interval)
+	})
+}
+
+func (c *Client) stopHeartbeat() {
+	c.heartBeatTicker.Reset(heartbeatDisabled)
+	c.updateStatus(func(s *Status) {
+		s.NextHeartbeat = time.Time{}
+	})
+}
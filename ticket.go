@@ -0,0 +1,71 @@
+package esurfing
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ticketRefreshMargin is how long before expiry a ticket is refreshed,
+// capped at a tenth of its remaining lifetime for short-lived tickets.
+const ticketRefreshMargin = 5 * time.Minute
+
+// maxTicketLifetime bounds the lifetime a portal may announce, so a bogus
+// value can neither overflow nor park the refresh forever.
+const maxTicketLifetime = 365 * 24 * time.Hour
+
+// parseExpire reads TicketResponse.Expire, either a lifetime in seconds or a
+// local date time. An empty value means the portal sent no expiry.
+func parseExpire(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 || seconds > int(maxTicketLifetime/time.Second) {
+			return time.Time{}, errors.New("ticket expire out of range: " + value)
+		}
+		return now.Add(time.Duration(seconds) * time.Second), nil
+	}
+	expiry, err := time.ParseInLocation(time.DateTime, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("invalid ticket expire: " + value)
+	}
+	//a date in the past would refresh in a loop, one far ahead never
+	if !expiry.After(now) || expiry.Sub(now) > maxTicketLifetime {
+		return time.Time{}, errors.New("ticket expire out of range: " + value)
+	}
+	return expiry, nil
+}
+
+// refreshAt is when a ticket expiring at expiry should be refreshed.
+func refreshAt(expiry, now time.Time) time.Time {
+	margin := min(ticketRefreshMargin, expiry.Sub(now)/10)
+	return expiry.Add(-margin)
+}
+
+// errNoRefreshURL is returned for sessions resumed from a state file written
+// before the ticket and auth URLs were saved.
+var errNoRefreshURL = errors.New("no ticket url to refresh from")
+
+// RefreshTicket fetches a new ticket and logs in with it while the session
+// is still alive, avoiding the outage of a full re-auth.
+func (c *Client) RefreshTicket() error {
+	if c.cipher == nil || c.TicketUrl == "" || c.AuthUrl == "" {
+		return errNoRefreshURL
+	}
+
+	if err := c.stage("GetTicket", c.GetTicket); err != nil {
+		return err
+	}
+	if err := c.stage("Login", c.Login); err != nil {
+		return err
+	}
+
+	c.syncStatus()
+	if err := c.saveSession(); err != nil {
+		c.Log.Warn("save state file error", "err", err)
+	}
+	return nil
+}
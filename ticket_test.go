@@ -0,0 +1,39 @@
+package esurfing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpire(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.Local)
+	tests := []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{value: ""},
+		{value: " 600 ", want: now.Add(600 * time.Second)},
+		{value: "31536000", want: now.Add(maxTicketLifetime)},
+		{value: "31536001", err: true},
+		{value: "0", err: true},
+		{value: "-5", err: true},
+		{value: "2026-01-02 16:04:05", want: now.Add(time.Hour)},
+		{value: "2027-01-02 15:04:05", want: now.Add(maxTicketLifetime)},
+		{value: "2027-01-02 15:04:06", err: true},
+		{value: "2026-01-02 15:04:05", err: true},
+		{value: "2025-12-31 00:00:00", err: true},
+		{value: "tomorrow", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseExpire(tt.value, now)
+			if (err != nil) != tt.err {
+				t.Fatalf("err %v, want error %v", err, tt.err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package trace records every HTTP exchange a client makes with the portal,
+// including the plaintext XML of encrypted requests and responses, as JSON
+// lines that can be read back with ReadFile.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const masked = "***"
+
+// Exchange is one request and its response. Encrypted exchanges carry the
+// XML on both sides instead of the ciphertext, which the built-in keys would
+// make trivial to decrypt.
+type Exchange struct {
+	Seq            int         `json:"seq"`
+	Session        int         `json:"session"`
+	Time           time.Time   `json:"time"`
+	DurationMs     float64     `json:"duration_ms"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	RequestXML     string      `json:"request_xml,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   string      `json:"response_body,omitempty"`
+	ResponseXML    string      `json:"response_xml,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	// Probe is set on connectivity probes.
+	Probe *Probe `json:"probe,omitempty"`
+}
+
+// Probe is what a connectivity probe expected, so a replay can run the same
+// check. Status and Body are the expected response, Quorum is how many of
+// the probes of one check had to succeed.
+type Probe struct {
+	Status int    `json:"status"`
+	Body   string `json:"body,omitempty"`
+	Quorum int    `json:"quorum"`
+}
+
+// Note carries the plaintext of an encrypted exchange from the code that
+// encrypts and decrypts it to the recorder, or marks a probe. ResponseXML
+// must be set before the response body is closed.
+type Note struct {
+	RequestXML  []byte
+	ResponseXML []byte
+	Probe       *Probe
+}
+
+type noteKey struct{}
+
+func WithNote(ctx context.Context, note *Note) context.Context {
+	return context.WithValue(ctx, noteKey{}, note)
+}
+
+func noteFrom(ctx context.Context) *Note {
+	note, _ := ctx.Value(noteKey{}).(*Note)
+	return note
+}
+
+// secretElements are the XML elements that let someone replaying them log in
+// or hijack a session: the password, the session ticket and the device id.
+var secretElements = map[string]*regexp.Regexp{
+	"passwd":    regexp.MustCompile(`(?s)<passwd>.*?</passwd>`),
+	"ticket":    regexp.MustCompile(`(?s)<ticket>.*?</ticket>`),
+	"client-id": regexp.MustCompile(`(?s)<client-id>.*?</client-id>`),
+}
+
+// secretHeaders repeat values of secretElements outside the encrypted body.
+var secretHeaders = []string{"Client-ID"}
+
+// Recorder writes exchanges to its directory, starting a new file for every session.
+type Recorder struct {
+	dir    string
+	prefix string
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	seq     int
+	session int
+	//probes are held back and written with whatever follows them, so the
+	//probes that start an auth land in that auth's session file
+	pending []*Exchange
+}
+
+// NewRecorder records into dir using file names starting with prefix.
+func NewRecorder(dir, prefix string) *Recorder {
+	return &Recorder{dir: dir, prefix: prefix}
+}
+
+// StartSession ends the current trace file; the next exchange opens a new one.
+func (r *Recorder) StartSession() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.closeFile()
+	r.session++
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.flushPending()
+	if cerr := r.closeFile(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file, r.writer = nil, nil
+	return err
+}
+
+func (r *Recorder) write(e *Exchange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.Probe != nil {
+		r.pending = append(r.pending, e)
+		return nil
+	}
+	if err := r.flushPending(); err != nil {
+		return err
+	}
+	return r.writeLocked(e)
+}
+
+func (r *Recorder) flushPending() error {
+	pending := r.pending
+	r.pending = nil
+	for _, e := range pending {
+		if err := r.writeLocked(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Recorder) writeLocked(e *Exchange) error {
+	if r.file == nil {
+		if err := os.MkdirAll(r.dir, 0700); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%s-%d.jsonl", r.prefix, time.Now().Format("20060102-150405"), r.session)
+		file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		r.file, r.writer = file, bufio.NewWriter(file)
+	}
+
+	e.Session = r.session
+	//keep the XML readable, the default escapes every angle bracket
+	enc := json.NewEncoder(r.writer)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e); err != nil {
+		return err
+	}
+	return r.writer.Flush()
+}
+
+func (r *Recorder) nextSeq() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	return r.seq
+}
+
+// maskXML hides the values of secretElements.
+func maskXML(data []byte) string {
+	for name, element := range secretElements {
+		data = element.ReplaceAll(data, []byte("<"+name+">"+masked+"</"+name+">"))
+	}
+	return string(data)
+}
+
+func maskHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, masked)
+		}
+	}
+	return h
+}
+
+// Transport returns a RoundTripper that records every exchange made through next.
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: r, next: next}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &Exchange{
+		Seq:           t.recorder.nextSeq(),
+		Time:          time.Now(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: maskHeader(req.Header),
+	}
+	note := noteFrom(req.Context())
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if note == nil {
+			e.RequestBody = string(body)
+		}
+	}
+	if note != nil {
+		e.RequestXML = maskXML(note.RequestXML)
+		e.Probe = note.Probe
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		e.DurationMs = durationMs(time.Since(e.Time))
+		e.Error = err.Error()
+		_ = t.recorder.write(e)
+		return nil, err
+	}
+
+	//portal responses are small, buffer them so timing covers the whole body
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	e.DurationMs = durationMs(time.Since(e.Time))
+	e.Status = resp.StatusCode
+	e.ResponseHeader = resp.Header.Clone()
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	resp.Body = &recordedBody{Reader: bytes.NewReader(body), close: func() {
+		if note != nil && note.ResponseXML != nil {
+			e.ResponseXML = maskXML(note.ResponseXML)
+		} else {
+			e.ResponseBody = string(body)
+		}
+		_ = t.recorder.write(e)
+	}}
+	return resp, nil
+}
+
+type recordedBody struct {
+	*bytes.Reader
+	once  sync.Once
+	close func()
+}
+
+func (b *recordedBody) Close() error {
+	b.once.Do(b.close)
+	return nil
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// ReadFile loads a trace file, ordered by sequence number.
+func ReadFile(path string) ([]Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var exchanges []Exchange
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e Exchange
+		if err = json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+
+	sort.SliceStable(exchanges, func(i, j int) bool {
+		return exchanges[i].Seq < exchanges[j].Seq
+	})
+	return exchanges, nil
+}
@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// InNetns runs fn on an OS thread that has entered the named network
+// namespace, so every socket fn creates belongs to it. name is a namespace
+// under /var/run/netns as created by ip netns, or a path to a namespace
+// file; empty runs fn as is.
+func InNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join("/var/run/netns", name)
+	}
+	target, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("netns %s: %w", name, err)
+	}
+	defer func() {
+		_ = target.Close()
+	}()
+
+	//a fresh goroutine, so the caller's thread is never touched
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		orig, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			result <- fmt.Errorf("netns %s: %w", name, err)
+			return
+		}
+		defer func() {
+			_ = orig.Close()
+		}()
+
+		if err = setns(target.Fd()); err != nil {
+			runtime.UnlockOSThread()
+			result <- fmt.Errorf("netns %s: setns: %w", name, err)
+			return
+		}
+		err = fn()
+		//a thread stuck in the namespace stays locked and exits with this goroutine
+		if setns(orig.Fd()) == nil {
+			runtime.UnlockOSThread()
+		}
+		result <- err
+	}()
+	return <-result
+}
+
+// setns(2) numbers, package syscall only knows them for a few architectures
+var sysSetns = map[string]uintptr{
+	"386":      346,
+	"amd64":    308,
+	"arm":      375,
+	"arm64":    268,
+	"loong64":  268,
+	"riscv64":  268,
+	"mips":     4344,
+	"mipsle":   4344,
+	"mips64":   5303,
+	"mips64le": 5303,
+	"ppc64":    350,
+	"ppc64le":  350,
+	"s390x":    339,
+}
+
+func setns(fd uintptr) error {
+	trap, ok := sysSetns[runtime.GOARCH]
+	if !ok {
+		return syscall.ENOSYS
+	}
+	_, _, errno := syscall.RawSyscall(trap, fd, syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
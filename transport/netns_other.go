@@ -0,0 +1,14 @@
+//go:build !linux
+
+package transport
+
+import "errors"
+
+// InNetns runs fn as is when name is empty. Network namespaces only exist
+// on Linux, anything else is an error.
+func InNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	return errors.New("netns is only supported on linux")
+}
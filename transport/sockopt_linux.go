@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// CheckSocketOptions reports whether Fwmark and BindToDevice can be applied,
+// which on Linux only fails later for lack of privileges.
+func (o Options) CheckSocketOptions() error {
+	return nil
+}
+
+// control applies Fwmark and BindToDevice to a socket before it connects.
+func (o Options) control(network, address string, c syscall.RawConn) error {
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		if o.Fwmark != 0 {
+			if err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, o.Fwmark); err != nil {
+				err = fmt.Errorf("set fwmark %#x: %w", o.Fwmark, err)
+				return
+			}
+		}
+		if o.BindToDevice {
+			if err = syscall.BindToDevice(int(fd), o.BindInterface); err != nil {
+				err = fmt.Errorf("bind to device %s: %w", o.BindInterface, err)
+			}
+		}
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+// CheckSocketOptions rejects Fwmark and BindToDevice, both are Linux socket
+// options.
+func (o Options) CheckSocketOptions() error {
+	if o.socketOptions() {
+		return errors.New("fwmark and bind_to_device are only supported on linux")
+	}
+	return nil
+}
+
+func (o Options) control(network, address string, c syscall.RawConn) error {
+	return o.CheckSocketOptions()
+}
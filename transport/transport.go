@@ -0,0 +1,290 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Options describes how the sockets of one account are created.
+type Options struct {
+	BindInterface string
+	DnsAddress    string
+	// Netns is the network namespace sockets are created in, see InNetns.
+	Netns string
+	// Fwmark is the SO_MARK set on every socket, for policy routing; 0 = none.
+	Fwmark int
+	// BindToDevice binds every socket to BindInterface with SO_BINDTODEVICE,
+	// so traffic leaves through it whatever the routing table says.
+	BindToDevice bool
+}
+
+// socketOptions reports whether sockets need control applied.
+func (o Options) socketOptions() bool {
+	return o.Fwmark != 0 || o.BindToDevice
+}
+
+func GetInterfaceMAC(interfaceName string) (string, error) {
+	iFace, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return "", fmt.Errorf("interface not found: %v", err)
+	}
+	if len(iFace.HardwareAddr) != 6 {
+		return "", fmt.Errorf("interface %s has no ethernet MAC address", interfaceName)
+	}
+	return iFace.HardwareAddr.String(), nil
+}
+
+func GetInterfaceIP(interfaceName string) (string, error) {
+	iFace, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return "", fmt.Errorf("interface not found: %v", err)
+	}
+
+	if iFace.Flags&net.FlagUp == 0 {
+		return "", fmt.Errorf("interface %s is down", interfaceName)
+	}
+
+	addresses, err := iFace.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("can not get addresses from interface %s: %v", interfaceName, err)
+	}
+
+	for _, addr := range addresses {
+		var ip net.IP
+		switch v := addr.(type) {
+		case *net.IPNet:
+			ip = v.IP
+		case *net.IPAddr:
+			ip = v.IP
+		default:
+			continue
+		}
+
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		ipv4 := ip.To4()
+		if ipv4 == nil {
+			continue
+		}
+
+		return ipv4.String(), nil
+	}
+
+	return "", fmt.Errorf("no available ipv4 address at interface %s", interfaceName)
+}
+
+// GetInterfaceIPv6 returns the first global IPv6 address of the interface,
+// skipping link-local and unique local addresses.
+func GetInterfaceIPv6(interfaceName string) (string, error) {
+	iFace, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return "", fmt.Errorf("interface not found: %v", err)
+	}
+
+	addresses, err := iFace.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("can not get addresses from interface %s: %v", interfaceName, err)
+	}
+
+	for _, addr := range addresses {
+		v, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if isGlobalIPv6(v.IP) {
+			return v.IP.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no global ipv6 address at interface %s", interfaceName)
+}
+
+// DefaultIPv6 returns the source address the system would use for IPv6
+// traffic to the internet. Connecting a UDP socket sends no packet.
+func DefaultIPv6() (string, error) {
+	conn, err := net.Dial("udp6", "[240c::6666]:53")
+	if err != nil {
+		return "", fmt.Errorf("no ipv6 route: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if !isGlobalIPv6(ip) {
+		return "", fmt.Errorf("no global ipv6 address, default source is %s", ip)
+	}
+	return ip.String(), nil
+}
+
+func isGlobalIPv6(ip net.IP) bool {
+	return ip.To4() == nil && ip.To16() != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// NewIPv6Transport returns a transport that only connects over IPv6, from
+// the interface's current global address when BindInterface is set.
+func NewIPv6Transport(o Options) http.RoundTripper {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var local net.IP
+			if o.BindInterface != "" {
+				//looked up on every dial, privacy addresses come and go
+				var ip string
+				err := InNetns(o.Netns, func() (err error) {
+					ip, err = GetInterfaceIPv6(o.BindInterface)
+					return err
+				})
+				if err != nil {
+					return nil, err
+				}
+				local = net.ParseIP(ip)
+			}
+			return o.dialContext(ctx, "tcp6", address, local)
+		},
+	}
+}
+
+// NewHttpTransport returns the transport for IPv4 portal traffic. With
+// BindInterface set, every dial starts from the interface's current address,
+// so the transport keeps working across DHCP renews and an interface that is
+// down at startup; connections kept alive from an old address are dropped as
+// soon as a change is seen.
+func NewHttpTransport(o Options) http.RoundTripper {
+	t := &http.Transport{}
+	if o.BindInterface == "" {
+		t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return o.dialContext(ctx, network, address, nil)
+		}
+		return t
+	}
+
+	d := &boundDialer{options: o, changed: t.CloseIdleConnections}
+	t.DialContext = d.DialContext
+	return t
+}
+
+type boundDialer struct {
+	options Options
+	changed func()
+
+	mu sync.Mutex
+	ip string
+}
+
+func (d *boundDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var ip string
+	err := InNetns(d.options.Netns, func() (err error) {
+		ip, err = GetInterfaceIP(d.options.BindInterface)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New(fmt.Errorf("failed to get interface IP: %w", err).Error())
+	}
+
+	d.mu.Lock()
+	changed := d.ip != "" && d.ip != ip
+	d.ip = ip
+	d.mu.Unlock()
+	if changed {
+		d.changed()
+	}
+
+	return d.options.dialContext(ctx, network, address, net.ParseIP(ip))
+}
+
+// dialContext dials address from local, if set, with the socket created in
+// Netns. Inside a namespace the host is resolved up front and only the
+// socket of each address is created in there, because the resolver runs
+// its lookups on goroutines of its own.
+func (o Options) dialContext(ctx context.Context, network, address string, local net.IP) (net.Conn, error) {
+	d := &net.Dialer{Resolver: o.resolver()}
+	if local != nil {
+		d.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	if o.socketOptions() {
+		d.Control = o.control
+	}
+	if o.Netns == "" {
+		return d.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4":
+		ipNetwork = "ip4"
+	case "tcp6":
+		ipNetwork = "ip6"
+	}
+	addrs, err := d.Resolver.LookupNetIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		var conn net.Conn
+		err = InNetns(o.Netns, func() (err error) {
+			conn, err = d.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			return err
+		})
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// resolver is GetResolver, with the DNS sockets created in Netns and the
+// socket options applied to them as well.
+func (o Options) resolver() *net.Resolver {
+	if o.Netns == "" && !o.socketOptions() {
+		return GetResolver(o.DnsAddress)
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if o.DnsAddress != "" {
+				network, address = "udp", o.DnsAddress
+			}
+			var conn net.Conn
+			err := InNetns(o.Netns, func() (err error) {
+				d := net.Dialer{
+					Timeout: 5 * time.Second,
+				}
+				if o.socketOptions() {
+					d.Control = o.control
+				}
+				conn, err = d.DialContext(ctx, network, address)
+				return err
+			})
+			return conn, err
+		},
+	}
+}
+
+func GetResolver(dnsAddress string) *net.Resolver {
+	if dnsAddress == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{
+				Timeout: 5 * time.Second,
+			}
+			return d.DialContext(ctx, "udp", dnsAddress)
+		},
+	}
+}
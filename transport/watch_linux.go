@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// multicast groups from linux/rtnetlink.h, not exported by package syscall
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// WatchInterface subscribes to link and address changes of the named
+// interface in netns, see InNetns, over netlink. A value is sent on the returned channel after
+// every change; changes that arrive while one is still pending are merged
+// into it. The channel is closed once ctx is done or the socket fails.
+func WatchInterface(ctx context.Context, netns, name string) (<-chan struct{}, error) {
+	var fd int
+	err := InNetns(netns, func() (err error) {
+		fd, err = syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE)
+		return err
+	})
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	})
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	//non-blocking, so reads go through the runtime poller and Close interrupts them
+	file := os.NewFile(uintptr(fd), "netlink")
+	events := make(chan struct{}, 1)
+
+	go func() {
+		<-ctx.Done()
+		_ = file.Close()
+	}()
+
+	go func() {
+		defer close(events)
+		buf := make([]byte, os.Getpagesize()*4)
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				//ENOBUFS means events were dropped, whatever they were is worth a check
+				if !errors.Is(err, syscall.ENOBUFS) {
+					return
+				}
+				notify(events)
+				continue
+			}
+			messages, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, m := range messages {
+				if interfaceName(netns, m) == name {
+					notify(events)
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func notify(events chan struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
+
+// interfaceName returns the interface a link or address message is about,
+// empty for any other message.
+func interfaceName(netns string, m syscall.NetlinkMessage) string {
+	switch m.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		//the interface may already be gone, so use the name carried in the message
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return ""
+		}
+		for _, a := range attrs {
+			if a.Attr.Type == syscall.IFLA_IFNAME {
+				return string(trimNul(a.Value))
+			}
+		}
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(m.Data) < syscall.SizeofIfAddrmsg {
+			return ""
+		}
+		msg := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		var iFace *net.Interface
+		err := InNetns(netns, func() (err error) {
+			iFace, err = net.InterfaceByIndex(int(msg.Index))
+			return err
+		})
+		if err != nil {
+			return ""
+		}
+		return iFace.Name
+	}
+	return ""
+}
+
+func trimNul(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
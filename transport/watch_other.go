@@ -0,0 +1,14 @@
+//go:build !linux
+
+package transport
+
+import (
+	"context"
+	"errors"
+)
+
+// WatchInterface is only implemented on Linux; elsewhere interface changes
+// are noticed by the regular connectivity check.
+func WatchInterface(ctx context.Context, netns, name string) (<-chan struct{}, error) {
+	return nil, errors.New("interface events are not supported on this platform")
+}
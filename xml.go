@@ -1,131 +1,58 @@
-package main
+package esurfing
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"io"
 	"time"
-)
 
-const (
-	UserAgentAndroid = "CCTP/android64_vpn/2093"
+	"github.com/DreamwareN/Esurfing-go/protocol"
+	"github.com/DreamwareN/Esurfing-go/trace"
 )
 
-type TicketRequest struct {
-	XMLName   xml.Name `xml:"request"`
-	Text      string   `xml:",chardata"`
-	UserAgent string   `xml:"user-agent"`
-	ClientID  string   `xml:"client-id"`
-	LocalTime string   `xml:"local-time"`
-	HostName  string   `xml:"host-name"`
-	Ipv4      string   `xml:"ipv4"`
-	Ipv6      string   `xml:"ipv6"`
-	Mac       string   `xml:"mac"`
-	Ostag     string   `xml:"ostag"`
-	Gwip      string   `xml:"gwip"`
-}
-
-type TicketResponse struct {
-	XMLName xml.Name `xml:"response"`
-	Text    string   `xml:",chardata"`
-	Ticket  string   `xml:"ticket"`
-	Expire  string   `xml:"expire"`
-}
-
-type LoginRequest struct {
-	XMLName   xml.Name `xml:"request"`
-	Text      string   `xml:",chardata"`
-	UserAgent string   `xml:"user-agent"`
-	ClientID  string   `xml:"client-id"`
-	Ticket    string   `xml:"ticket"`
-	LocalTime string   `xml:"local-time"`
-	Userid    string   `xml:"userid"`
-	Passwd    string   `xml:"passwd"`
-}
-
-type LoginResponse struct {
-	XMLName    xml.Name `xml:"response"`
-	Text       string   `xml:",chardata"`
-	Userid     string   `xml:"userid"`
-	KeepRetry  string   `xml:"keep-retry"`
-	KeepURL    string   `xml:"keep-url"`
-	TermURL    string   `xml:"term-url"`
-	UserConfig struct {
-		Text            string `xml:",chardata"`
-		AgainstInterval string `xml:"against-interval"`
-	} `xml:"user-config"`
-	DomainConfig string `xml:"domain-config"`
-}
-
-type State struct {
-	XMLName   xml.Name `xml:"request"`
-	Text      string   `xml:",chardata"`
-	UserAgent string   `xml:"user-agent"`
-	ClientID  string   `xml:"client-id"`
-	LocalTime string   `xml:"local-time"`
-	HostName  string   `xml:"host-name"`
-	Ipv4      string   `xml:"ipv4"`
-	Ticket    string   `xml:"ticket"`
-	Ipv6      string   `xml:"ipv6"`
-	Mac       string   `xml:"mac"`
-	Ostag     string   `xml:"ostag"`
-}
-
-type StateResponse struct {
-	XMLName  xml.Name `xml:"response"`
-	Text     string   `xml:",chardata"`
-	Interval string   `xml:"interval"`
-	Level    string   `xml:"level"`
-}
-
-type EConfig struct {
-	XMLName   xml.Name `xml:"config"`
-	Text      string   `xml:",chardata"`
-	TicketURL string   `xml:"ticket-url"`
-	AuthURL   string   `xml:"auth-url"`
-	//delete useless field
-}
-
 func (c *Client) GenerateGetTicketXML() ([]byte, error) {
-	tr := TicketRequest{
-		UserAgent: UserAgentAndroid,
+	tr := protocol.TicketRequest{
+		UserAgent: c.Profile.UserAgent,
 		ClientID:  c.ClientID.String(),
 		LocalTime: time.Now().Format(time.DateTime),
 		HostName:  c.Hostname,
 		Ipv4:      c.UserIP,
+		Ipv6:      c.UserIPv6,
 		Mac:       c.MacAddress,
-		Ostag:     c.Hostname,
+		Ostag:     c.Profile.FormatOstag(c.Hostname),
 		Gwip:      c.AcIP,
 	}
 	out, err := xml.Marshal(tr)
 	if err != nil {
 		return nil, err
 	}
-	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), out...), nil
+	return append([]byte(protocol.XMLHeader), out...), nil
 }
 
 func (c *Client) GenerateStateXML() ([]byte, error) {
-	s := &State{
-		UserAgent: UserAgentAndroid,
+	s := &protocol.State{
+		UserAgent: c.Profile.UserAgent,
 		ClientID:  c.ClientID.String(),
 		LocalTime: time.Now().Format(time.DateTime),
 		HostName:  c.Hostname,
 		Ipv4:      c.UserIP,
+		Ipv6:      c.UserIPv6,
 		Ticket:    c.Ticket,
 		Mac:       c.MacAddress,
-		Ostag:     c.Hostname,
+		Ostag:     c.Profile.FormatOstag(c.Hostname),
 	}
 	bytes, err := xml.Marshal(s)
 	if err != nil {
 		return nil, err
 	}
 
-	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), bytes...), nil
+	return append([]byte(protocol.XMLHeader), bytes...), nil
 }
 
 func (c *Client) GenerateLoginXML() ([]byte, error) {
-	lr := &LoginRequest{
-		UserAgent: UserAgentAndroid,
+	lr := &protocol.LoginRequest{
+		UserAgent: c.Profile.UserAgent,
 		ClientID:  c.ClientID.String(),
 		Ticket:    c.Ticket,
 		LocalTime: time.Now().Format(time.DateTime),
@@ -138,46 +65,29 @@ func (c *Client) GenerateLoginXML() ([]byte, error) {
 		return nil, err
 	}
 
-	return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"), bytes...), nil
+	return append([]byte(protocol.XMLHeader), bytes...), nil
 }
 
 func (c *Client) PostXML(url string, data []byte) ([]byte, error) {
-	encXML, err := c.cipher.Encrypt(data)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := c.NewPostRequest(url, encXML)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := c.HttpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(response.Body)
-
-	data, err = io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return c.cipher.Decrypt(data)
+	return c.postXML(c.Ctx, url, data)
 }
 
 func (c *Client) PostXMLWithTimeout(url string, data []byte) ([]byte, error) {
-	//set timeout 1s to ensure program not blocking after ctrl+c
+	//set timeout 3s to ensure program not blocking after ctrl+c
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*3))
 	defer cancel()
+	return c.postXML(ctx, url, data)
+}
+
+func (c *Client) postXML(ctx context.Context, url string, data []byte) ([]byte, error) {
+	note := &trace.Note{RequestXML: bytes.Clone(data)}
+
 	encXML, err := c.cipher.Encrypt(data)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.NewPostRequestWithCustomCtx(ctx, url, encXML)
+	req, err := c.NewPostRequestWithCustomCtx(trace.WithNote(ctx, note), url, encXML)
 	if err != nil {
 		return nil, err
 	}
@@ -195,5 +105,6 @@ func (c *Client) PostXMLWithTimeout(url string, data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return c.cipher.Decrypt(data)
+	note.ResponseXML, err = c.cipher.Decrypt(data)
+	return note.ResponseXML, err
 }